@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"time"
+
+	hclog "github.com/hashicorp/go-hclog"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/uber/jaeger-lib/metrics"
+	jprom "github.com/uber/jaeger-lib/metrics/prometheus"
+)
+
+const (
+	metricsNamespace   = "jaeger_duckdb"
+	healthCheckTimeout = time.Second * 5
+)
+
+// healthChecker is implemented by storage.Store
+type healthChecker interface {
+	Ping(ctx context.Context) error
+	Ready(ctx context.Context) error
+}
+
+// adminServer exposes the plugin's own telemetry over HTTP
+type adminServer struct {
+	logger   hclog.Logger
+	registry *prometheus.Registry
+	mux      *http.ServeMux
+	server   *http.Server
+}
+
+func newAdminServer(logger hclog.Logger) *adminServer {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+
+	return &adminServer{
+		logger:   logger,
+		registry: registry,
+		mux:      mux,
+	}
+}
+
+// metricsFactory returns a factory whose metrics are served on /metrics
+func (s *adminServer) metricsFactory() metrics.Factory {
+	return jprom.New(jprom.WithRegisterer(s.registry)).Namespace(metrics.NSOptions{Name: metricsNamespace})
+}
+
+// registerHealthChecks serves /healthz and /readyz using checker
+func (s *adminServer) registerHealthChecks(checker healthChecker) {
+	s.mux.HandleFunc("/healthz", s.healthHandler(checker.Ping))
+	s.mux.HandleFunc("/readyz", s.healthHandler(checker.Ready))
+}
+
+func (s *adminServer) healthHandler(check func(ctx context.Context) error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), healthCheckTimeout)
+		defer cancel()
+
+		if err := check(ctx); err != nil {
+			s.logger.Warn("Health check failed", "path", r.URL.Path, "error", err)
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+
+		_, _ = w.Write([]byte("ok"))
+	}
+}
+
+// registerPprof serves the runtime profiles under /debug/pprof/
+func (s *adminServer) registerPprof() {
+	s.mux.HandleFunc("/debug/pprof/", pprof.Index)
+	s.mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	s.mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	s.mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	s.mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+}
+
+// start serves the admin endpoints on endpoint in the background
+func (s *adminServer) start(endpoint string) error {
+	listener, err := net.Listen("tcp", endpoint)
+	if err != nil {
+		return fmt.Errorf("could not listen on %s: %w", endpoint, err)
+	}
+
+	s.server = &http.Server{Handler: s.mux}
+
+	go func() {
+		s.logger.Info("Starting admin HTTP server", "endpoint", endpoint)
+		if err := s.server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			s.logger.Error("Admin HTTP server stopped", "error", err)
+		}
+	}()
+
+	return nil
+}
+
+func (s *adminServer) Close() error {
+	if s.server == nil {
+		return nil
+	}
+	return s.server.Shutdown(context.Background())
+}
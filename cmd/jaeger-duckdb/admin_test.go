@@ -0,0 +1,38 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	hclog "github.com/hashicorp/go-hclog"
+	"github.com/stretchr/testify/assert"
+)
+
+// stubChecker is healthy and not ready
+type stubChecker struct{}
+
+func (stubChecker) Ping(context.Context) error {
+	return nil
+}
+
+func (stubChecker) Ready(context.Context) error {
+	return errors.New("span writer is backlogged: 900 spans queued")
+}
+
+func TestAdminServer_healthChecks(t *testing.T) {
+	admin := newAdminServer(hclog.NewNullLogger())
+	admin.registerHealthChecks(stubChecker{})
+
+	recorder := httptest.NewRecorder()
+	admin.mux.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "ok", recorder.Body.String())
+
+	recorder = httptest.NewRecorder()
+	admin.mux.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+	assert.Equal(t, "span writer is backlogged: 900 spans queued\n", recorder.Body.String())
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	hclog "github.com/hashicorp/go-hclog"
+	yaml "gopkg.in/yaml.v3"
+
+	"github.com/chhetripradeep/jaeger-duckdb/storage"
+)
+
+// envPrefix is prepended to the upper-cased yaml name of a field to get its environment variable
+const envPrefix = "DUCKDB_"
+
+var (
+	durationType    = reflect.TypeOf(time.Duration(0))
+	boolPointerType = reflect.TypeOf((*bool)(nil))
+)
+
+// configFlags holds the configuration values given on the command line, keyed by yaml name
+type configFlags map[string]string
+
+// configFlag sets one configuration field from the command line
+type configFlag struct {
+	name   string
+	isBool bool
+	values configFlags
+}
+
+func (f *configFlag) String() string {
+	if f == nil || f.values == nil {
+		return ""
+	}
+	return f.values[f.name]
+}
+
+func (f *configFlag) Set(value string) error {
+	f.values[f.name] = value
+	return nil
+}
+
+func (f *configFlag) IsBoolFlag() bool {
+	return f.isBool
+}
+
+// registerConfigFlags adds a flag for every configuration field to flags. A field named
+// batch_write_size in the config file is set with --batch-write-size or DUCKDB_BATCH_WRITE_SIZE.
+func registerConfigFlags(flags *flag.FlagSet) configFlags {
+	values := configFlags{}
+
+	configType := reflect.TypeOf(storage.Configuration{})
+	for i := 0; i < configType.NumField(); i++ {
+		field := configType.Field(i)
+		name := yamlName(field)
+		if name == "" {
+			continue
+		}
+
+		usage := fmt.Sprintf("Overrides %s of the config file and %s", name, envName(name))
+		if field.Type.Kind() == reflect.Map {
+			usage += ", given as key=value pairs separated by commas"
+		}
+
+		flags.Var(&configFlag{
+			name:   name,
+			isBool: field.Type.Kind() == reflect.Bool || field.Type == boolPointerType,
+			values: values,
+		}, strings.ReplaceAll(name, "_", "-"), usage)
+	}
+
+	return values
+}
+
+// loadConfig returns the configuration built from, in increasing order of precedence, the defaults,
+// the config file if any, the environment and the command line, along with a logger configured by it.
+func loadConfig(logger hclog.Logger, cfgPath string, flagValues configFlags) (storage.Configuration, hclog.Logger, error) {
+	var cfg storage.Configuration
+
+	if cfgPath != "" {
+		cfgFile, err := os.ReadFile(filepath.Clean(cfgPath))
+		if err != nil {
+			logger.Error("Failed to read config file", "config", cfgPath, "error", err)
+			return cfg, logger, err
+		}
+
+		err = yaml.Unmarshal(cfgFile, &cfg)
+		if err != nil {
+			logger.Error("Failed to parse config file", "config", cfgPath, "error", err)
+			return cfg, logger, err
+		}
+	}
+
+	if err := setConfigFields(&cfg, envValues()); err != nil {
+		logger.Error("Failed to read config from the environment", "error", err)
+		return cfg, logger, err
+	}
+
+	if err := setConfigFields(&cfg, flagValues); err != nil {
+		logger.Error("Failed to read config from the command line", "error", err)
+		return cfg, logger, err
+	}
+
+	cfg.SetDefaults()
+
+	configured, err := configuredLogger(cfg)
+	if err != nil {
+		logger.Error("Failed to configure logging", "config", cfgPath, "error", err)
+		return cfg, logger, err
+	}
+
+	return cfg, configured, nil
+}
+
+// envValues returns the configuration values set in the environment, keyed by yaml name
+func envValues() map[string]string {
+	values := make(map[string]string)
+
+	configType := reflect.TypeOf(storage.Configuration{})
+	for i := 0; i < configType.NumField(); i++ {
+		name := yamlName(configType.Field(i))
+		if name == "" {
+			continue
+		}
+		if value, ok := os.LookupEnv(envName(name)); ok {
+			values[name] = value
+		}
+	}
+
+	return values
+}
+
+// setConfigFields sets the fields of cfg named in values from their string representation
+func setConfigFields(cfg *storage.Configuration, values map[string]string) error {
+	config := reflect.ValueOf(cfg).Elem()
+	for i := 0; i < config.NumField(); i++ {
+		name := yamlName(config.Type().Field(i))
+		value, ok := values[name]
+		if name == "" || !ok {
+			continue
+		}
+		if err := setField(config.Field(i), value); err != nil {
+			return fmt.Errorf("invalid value %q for %s: %w", value, name, err)
+		}
+	}
+	return nil
+}
+
+func setField(field reflect.Value, value string) error {
+	if field.Type() == durationType {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		field.SetInt(int64(d))
+		return nil
+	}
+
+	switch field.Kind() {
+	case reflect.Pointer:
+		ptr, err := newFieldValue(field.Type().Elem(), value)
+		if err != nil {
+			return err
+		}
+		field.Set(ptr)
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+	case reflect.Int, reflect.Int64:
+		i, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return err
+		}
+		field.SetInt(i)
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return err
+		}
+		field.SetFloat(f)
+	case reflect.Map:
+		m := make(map[string]string)
+		for _, pair := range strings.Split(value, ",") {
+			if pair = strings.TrimSpace(pair); pair == "" {
+				continue
+			}
+			k, v, found := strings.Cut(pair, "=")
+			if !found {
+				return fmt.Errorf("%q is not a key=value pair", pair)
+			}
+			m[strings.TrimSpace(k)] = strings.TrimSpace(v)
+		}
+		field.Set(reflect.ValueOf(m))
+	default:
+		return fmt.Errorf("unsupported type %s", field.Type())
+	}
+	return nil
+}
+
+// newFieldValue returns a pointer to a new value of type t set from value
+func newFieldValue(t reflect.Type, value string) (reflect.Value, error) {
+	ptr := reflect.New(t)
+	if err := setField(ptr.Elem(), value); err != nil {
+		return reflect.Value{}, err
+	}
+	return ptr, nil
+}
+
+func yamlName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+	if name == "-" {
+		return ""
+	}
+	return name
+}
+
+func envName(name string) string {
+	return envPrefix + strings.ToUpper(name)
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadConfig_precedence(t *testing.T) {
+	cfgPath := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(cfgPath, []byte("datafile: /file.db\nencoding: protobuf\nbatch_write_size: 10\n"), 0o600))
+
+	t.Setenv("DUCKDB_DATAFILE", "/env.db")
+	t.Setenv("DUCKDB_ENCODING", "json")
+
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+	values := registerConfigFlags(flags)
+	require.NoError(t, flags.Parse([]string{
+		"--datafile", "/flag.db",
+		"--admin-pprof",
+		"--batch-flush-interval", "5s",
+		"--parquet-source-settings", "s3_region=eu-west-1, s3_use_ssl=false",
+	}))
+
+	cfg, _, err := loadConfig(newLogger(), cfgPath, values)
+	require.NoError(t, err)
+
+	assert.Equal(t, "/flag.db", cfg.DataFile)
+	assert.Equal(t, "json", cfg.Encoding)
+	assert.Equal(t, int64(10), cfg.BatchWriteSize)
+	assert.Equal(t, 5*time.Second, cfg.BatchFlushInterval)
+	assert.True(t, cfg.AdminPprof)
+	assert.Equal(t, map[string]string{"s3_region": "eu-west-1", "s3_use_ssl": "false"}, cfg.ParquetSourceSettings)
+	assert.Equal(t, "jaeger_spans", cfg.SpansTable)
+}
+
+func TestLoadConfig_invalidValue(t *testing.T) {
+	t.Setenv("DUCKDB_BATCH_WRITE_SIZE", "many")
+
+	_, _, err := loadConfig(newLogger(), "", configFlags{})
+	assert.ErrorContains(t, err, "batch_write_size")
+}
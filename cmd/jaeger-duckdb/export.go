@@ -0,0 +1,248 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	hclog "github.com/hashicorp/go-hclog"
+	"github.com/jaegertracing/jaeger/model"
+	uiconv "github.com/jaegertracing/jaeger/model/converter/json"
+	uimodel "github.com/jaegertracing/jaeger/model/json"
+	"github.com/jaegertracing/jaeger/storage/spanstore"
+	"github.com/uber/jaeger-lib/metrics"
+
+	"github.com/chhetripradeep/jaeger-duckdb/storage"
+)
+
+// uiResponse mirrors the response of the Jaeger query API so the UI can load it with "Upload JSON"
+type uiResponse struct {
+	Data   []*uimodel.Trace `json:"data"`
+	Total  int              `json:"total"`
+	Limit  int              `json:"limit"`
+	Offset int              `json:"offset"`
+	Errors []string         `json:"errors"`
+}
+
+// stringList collects the values of a flag given several times or as a comma separated list
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			*l = append(*l, v)
+		}
+	}
+	return nil
+}
+
+// runExport writes traces selected by ID or by a search query as Jaeger UI JSON
+func runExport(args []string) int {
+	var (
+		cfgPath     string
+		archive     bool
+		output      string
+		traceIDs    stringList
+		tags        stringList
+		service     string
+		operation   string
+		start       string
+		end         string
+		durationMin time.Duration
+		durationMax time.Duration
+		limit       int
+	)
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	flags.StringVar(&cfgPath, "config", "", "Absolute path of the DuckDB's Jaeger plugin")
+	configFlags := registerConfigFlags(flags)
+	flags.BoolVar(&archive, "archive", false, "Read traces from the archive storage instead of the primary storage")
+	flags.StringVar(&output, "output", "", "File to write the traces to, defaults to stdout")
+	flags.Var(&traceIDs, "trace-id", "Trace ID to export, may be repeated or comma separated")
+	flags.Var(&tags, "tag", "Tag filter as key=value, may be repeated")
+	flags.StringVar(&service, "service", "", "Service name to search for")
+	flags.StringVar(&operation, "operation", "", "Operation name to search for")
+	flags.StringVar(&start, "start", "", "Start of the searched time range (RFC3339), defaults to one hour before end")
+	flags.StringVar(&end, "end", "", "End of the searched time range (RFC3339), defaults to now")
+	flags.DurationVar(&durationMin, "duration-min", 0, "Minimum duration of a matching span, or of the whole trace with search_trace_duration")
+	flags.DurationVar(&durationMax, "duration-max", 0, "Maximum duration of a matching span, or of the whole trace with search_trace_duration")
+	flags.IntVar(&limit, "limit", 20, "Maximum number of traces to search for")
+	_ = flags.Parse(args)
+
+	logger := newLogger()
+
+	if len(traceIDs) == 0 && service == "" {
+		logger.Error("Either trace IDs or a service to search for are required")
+		return 1
+	}
+
+	cfg, logger, err := loadConfig(logger, cfgPath, configFlags)
+	if err != nil {
+		return 1
+	}
+
+	var query *spanstore.TraceQueryParameters
+	if len(traceIDs) == 0 {
+		query, err = buildTraceQuery(service, operation, tags, start, end, durationMin, durationMax, limit)
+		if err != nil {
+			logger.Error("Invalid search query", "error", err)
+			return 1
+		}
+	}
+
+	store, err := openReadOnlyStore(logger, cfg)
+	if err != nil {
+		logger.Error("Failed to open the data files, the plugin writing to them must be stopped", "error", err)
+		return 1
+	}
+	defer store.Close()
+
+	reader := store.SpanReader()
+	if archive {
+		reader = store.ArchiveSpanReader()
+	}
+
+	traces, err := readTraces(context.Background(), reader, traceIDs, query)
+	if err != nil {
+		logger.Error("Failed to read traces", "error", err)
+		return 1
+	}
+
+	response := uiResponse{Data: make([]*uimodel.Trace, 0, len(traces)), Total: len(traces)}
+	for _, trace := range traces {
+		response.Data = append(response.Data, uiconv.FromDomain(trace))
+	}
+
+	var out io.Writer = os.Stdout
+	if output != "" {
+		file, err := os.Create(filepath.Clean(output))
+		if err != nil {
+			logger.Error("Failed to create output file", "output", output, "error", err)
+			return 1
+		}
+		defer file.Close()
+		out = file
+	}
+
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(response); err != nil {
+		logger.Error("Failed to write traces", "error", err)
+		return 1
+	}
+
+	logger.Info("Exported traces", "traces", len(traces))
+
+	return 0
+}
+
+// readOnlyConfig returns cfg for a command that only reads the data files, so it neither runs the
+// init scripts nor starts background jobs.
+func readOnlyConfig(cfg storage.Configuration) storage.Configuration {
+	cfg.ReadOnly = true
+	cfg.ParquetExportInterval = 0
+	if cfg.TracingExporter == storage.TracingExporterSelf {
+		cfg.TracingExporter = "none"
+	}
+	return cfg
+}
+
+// openReadOnlyStore opens the data files of cfg for reading. DuckDB locks a data file for the whole
+// process that opens it for writing, the plugin writing to the files must be stopped first.
+func openReadOnlyStore(logger hclog.Logger, cfg storage.Configuration) (*storage.Store, error) {
+	store, err := storage.NewStore(logger, readOnlyConfig(cfg), metrics.NullFactory)
+	if err != nil {
+		return nil, err
+	}
+
+	// A read-only store retries opening the data files in the background, a command fails at once
+	if err := store.Ping(context.Background()); err != nil {
+		_ = store.Close()
+		return nil, err
+	}
+
+	return store, nil
+}
+
+// readTraces returns the traces with the given IDs, or the traces matching query when there are none
+func readTraces(ctx context.Context, reader spanstore.Reader, traceIDs []string, query *spanstore.TraceQueryParameters) ([]*model.Trace, error) {
+	if len(traceIDs) > 0 {
+		return getTraces(ctx, reader, traceIDs)
+	}
+	return reader.FindTraces(ctx, query)
+}
+
+func getTraces(ctx context.Context, reader spanstore.Reader, traceIDs []string) ([]*model.Trace, error) {
+	traces := make([]*model.Trace, 0, len(traceIDs))
+	for _, id := range traceIDs {
+		traceID, err := model.TraceIDFromString(id)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trace ID %q: %w", id, err)
+		}
+
+		trace, err := reader.GetTrace(ctx, traceID)
+		if errors.Is(err, spanstore.ErrTraceNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		traces = append(traces, trace)
+	}
+	return traces, nil
+}
+
+func buildTraceQuery(
+	service, operation string,
+	tags []string,
+	start, end string,
+	durationMin, durationMax time.Duration,
+	limit int,
+) (*spanstore.TraceQueryParameters, error) {
+	query := &spanstore.TraceQueryParameters{
+		ServiceName:   service,
+		OperationName: operation,
+		Tags:          make(map[string]string, len(tags)),
+		StartTimeMax:  time.Now(),
+		DurationMin:   durationMin,
+		DurationMax:   durationMax,
+		NumTraces:     limit,
+	}
+
+	for _, tag := range tags {
+		key, value, found := strings.Cut(tag, "=")
+		if !found {
+			return nil, fmt.Errorf("invalid tag %q, expected key=value", tag)
+		}
+		query.Tags[key] = value
+	}
+
+	if end != "" {
+		endTime, err := time.Parse(time.RFC3339, end)
+		if err != nil {
+			return nil, fmt.Errorf("invalid end time %q: %w", end, err)
+		}
+		query.StartTimeMax = endTime
+	}
+
+	query.StartTimeMin = query.StartTimeMax.Add(-time.Hour)
+	if start != "" {
+		startTime, err := time.Parse(time.RFC3339, start)
+		if err != nil {
+			return nil, fmt.Errorf("invalid start time %q: %w", start, err)
+		}
+		query.StartTimeMin = startTime
+	}
+
+	return query, nil
+}
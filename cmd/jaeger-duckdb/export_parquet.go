@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"time"
+
+	"github.com/uber/jaeger-lib/metrics"
+
+	"github.com/chhetripradeep/jaeger-duckdb/storage"
+)
+
+// runExportParquet moves a time range of spans from the live tables to Parquet files
+func runExportParquet(args []string) int {
+	var cfgPath, start, end string
+	flags := flag.NewFlagSet("export-parquet", flag.ExitOnError)
+	flags.StringVar(&cfgPath, "config", "", "Absolute path of the DuckDB's Jaeger plugin")
+	configFlags := registerConfigFlags(flags)
+	flags.StringVar(&start, "start", "", "Start of the exported time range (RFC3339, inclusive)")
+	flags.StringVar(&end, "end", "", "End of the exported time range (RFC3339, exclusive)")
+	_ = flags.Parse(args)
+
+	logger := newLogger()
+
+	startTime, err := time.Parse(time.RFC3339, start)
+	if err != nil {
+		logger.Error("Failed to parse start time", "start", start, "error", err)
+		return 1
+	}
+
+	endTime, err := time.Parse(time.RFC3339, end)
+	if err != nil {
+		logger.Error("Failed to parse end time", "end", end, "error", err)
+		return 1
+	}
+
+	cfg, logger, err := loadConfig(logger, cfgPath, configFlags)
+	if err != nil {
+		return 1
+	}
+
+	store, err := storage.NewStore(logger, cfg, metrics.NullFactory)
+	if err != nil {
+		logger.Error("Failed to create a storage plugin", "error", err)
+		return 1
+	}
+	defer store.Close()
+
+	files, err := store.ExportParquet(context.Background(), startTime, endTime)
+	if err != nil {
+		logger.Error("Failed to export spans to parquet", "error", err)
+		return 1
+	}
+
+	for _, file := range files {
+		logger.Info("Exported parquet file", "path", file.Path, "table", file.Table, "rows", file.RowCount)
+	}
+
+	return 0
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	hclog "github.com/hashicorp/go-hclog"
+	"github.com/jaegertracing/jaeger/model"
+	"github.com/jaegertracing/jaeger/storage/spanstore"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/jaeger-lib/metrics"
+
+	"github.com/chhetripradeep/jaeger-duckdb/storage"
+)
+
+// fakeReader serves fixed traces and records the last search query
+type fakeReader struct {
+	traces map[model.TraceID]*model.Trace
+	query  *spanstore.TraceQueryParameters
+}
+
+func (r *fakeReader) GetTrace(_ context.Context, traceID model.TraceID) (*model.Trace, error) {
+	if trace, ok := r.traces[traceID]; ok {
+		return trace, nil
+	}
+	return nil, spanstore.ErrTraceNotFound
+}
+
+func (r *fakeReader) GetServices(context.Context) ([]string, error) {
+	return nil, nil
+}
+
+func (r *fakeReader) GetOperations(context.Context, spanstore.OperationQueryParameters) ([]spanstore.Operation, error) {
+	return nil, nil
+}
+
+func (r *fakeReader) FindTraces(_ context.Context, query *spanstore.TraceQueryParameters) ([]*model.Trace, error) {
+	r.query = query
+	traces := make([]*model.Trace, 0, len(r.traces))
+	for _, trace := range r.traces {
+		traces = append(traces, trace)
+	}
+	return traces, nil
+}
+
+func (r *fakeReader) FindTraceIDs(context.Context, *spanstore.TraceQueryParameters) ([]model.TraceID, error) {
+	return nil, nil
+}
+
+func TestBuildTraceQuery(t *testing.T) {
+	query, err := buildTraceQuery("frontend", "GET /", []string{"http.status_code=500", "error=true"}, "", "", time.Millisecond, time.Second, 5)
+	require.NoError(t, err)
+	assert.Equal(t, "frontend", query.ServiceName)
+	assert.Equal(t, "GET /", query.OperationName)
+	assert.Equal(t, map[string]string{"http.status_code": "500", "error": "true"}, query.Tags)
+	assert.Equal(t, time.Millisecond, query.DurationMin)
+	assert.Equal(t, time.Second, query.DurationMax)
+	assert.Equal(t, 5, query.NumTraces)
+	assert.WithinDuration(t, time.Now(), query.StartTimeMax, time.Minute)
+	assert.Equal(t, query.StartTimeMax.Add(-time.Hour), query.StartTimeMin)
+
+	// The range starts an hour before its end unless the start is given too
+	query, err = buildTraceQuery("frontend", "", nil, "", "2022-01-01T10:00:00Z", 0, 0, 20)
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2022, 1, 1, 9, 0, 0, 0, time.UTC), query.StartTimeMin)
+	assert.Equal(t, time.Date(2022, 1, 1, 10, 0, 0, 0, time.UTC), query.StartTimeMax)
+	assert.Empty(t, query.Tags)
+
+	query, err = buildTraceQuery("frontend", "", nil, "2022-01-01T00:00:00Z", "2022-01-01T10:00:00Z", 0, 0, 20)
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC), query.StartTimeMin)
+
+	// A tag value may itself hold an equal sign
+	query, err = buildTraceQuery("frontend", "", []string{"db.statement=a=b"}, "", "", 0, 0, 20)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"db.statement": "a=b"}, query.Tags)
+
+	_, err = buildTraceQuery("frontend", "", []string{"error"}, "", "", 0, 0, 20)
+	assert.ErrorContains(t, err, `invalid tag "error"`)
+
+	_, err = buildTraceQuery("frontend", "", nil, "yesterday", "", 0, 0, 20)
+	assert.ErrorContains(t, err, `invalid start time "yesterday"`)
+
+	_, err = buildTraceQuery("frontend", "", nil, "", "now", 0, 0, 20)
+	assert.ErrorContains(t, err, `invalid end time "now"`)
+}
+
+func TestGetTraces(t *testing.T) {
+	found := &model.Trace{Spans: []*model.Span{{TraceID: model.NewTraceID(0, 1)}}}
+	reader := &fakeReader{traces: map[model.TraceID]*model.Trace{model.NewTraceID(0, 1): found}}
+
+	// Missing traces are left out
+	traces, err := getTraces(context.Background(), reader, []string{"1", "2"})
+	require.NoError(t, err)
+	assert.Equal(t, []*model.Trace{found}, traces)
+
+	_, err = getTraces(context.Background(), reader, []string{"not-hex"})
+	assert.ErrorContains(t, err, `invalid trace ID "not-hex"`)
+}
+
+func TestReadTraces(t *testing.T) {
+	found := &model.Trace{Spans: []*model.Span{{TraceID: model.NewTraceID(0, 1)}}}
+	reader := &fakeReader{traces: map[model.TraceID]*model.Trace{model.NewTraceID(0, 1): found}}
+	query := &spanstore.TraceQueryParameters{ServiceName: "frontend"}
+
+	// Trace IDs take precedence over the search query
+	traces, err := readTraces(context.Background(), reader, []string{"1"}, query)
+	require.NoError(t, err)
+	assert.Equal(t, []*model.Trace{found}, traces)
+	assert.Nil(t, reader.query)
+
+	traces, err = readTraces(context.Background(), reader, nil, query)
+	require.NoError(t, err)
+	assert.Equal(t, []*model.Trace{found}, traces)
+	assert.Same(t, query, reader.query)
+}
+
+func TestReadOnlyConfig(t *testing.T) {
+	cfg := storage.Configuration{
+		InitSQLScriptsDir:     t.TempDir(),
+		ParquetDir:            t.TempDir(),
+		ParquetExportInterval: time.Hour,
+		TracingExporter:       storage.TracingExporterSelf,
+	}
+	cfg.SetDefaults()
+
+	readOnly := readOnlyConfig(cfg)
+	assert.True(t, readOnly.ReadOnly)
+	assert.Zero(t, readOnly.ParquetExportInterval)
+	assert.Equal(t, "none", readOnly.TracingExporter)
+	assert.NoError(t, readOnly.Validate())
+	assert.False(t, cfg.ReadOnly)
+}
+
+func TestOpenReadOnlyStore(t *testing.T) {
+	cfg := storage.Configuration{
+		DataFile:          filepath.Join(t.TempDir(), "jaeger.db"),
+		InitSQLScriptsDir: "../../schema",
+	}
+	cfg.SetDefaults()
+
+	// The command fails at once rather than retrying in the background like the plugin
+	_, err := openReadOnlyStore(hclog.NewNullLogger(), cfg)
+	assert.Error(t, err)
+
+	store, err := storage.NewStore(hclog.NewNullLogger(), cfg, metrics.NullFactory)
+	require.NoError(t, err)
+	require.NoError(t, store.Close())
+
+	store, err = openReadOnlyStore(hclog.NewNullLogger(), cfg)
+	require.NoError(t, err)
+	assert.NoError(t, store.Close())
+}
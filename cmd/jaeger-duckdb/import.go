@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"os"
+	"path/filepath"
+
+	"github.com/jaegertracing/jaeger/model"
+	"github.com/uber/jaeger-lib/metrics"
+
+	"github.com/chhetripradeep/jaeger-duckdb/converter"
+	"github.com/chhetripradeep/jaeger-duckdb/storage"
+)
+
+type spanKey struct {
+	traceID model.TraceID
+	spanID  model.SpanID
+}
+
+// runImport writes spans from Jaeger UI JSON or OTLP JSON files into the store
+func runImport(args []string) int {
+	var (
+		cfgPath          string
+		archive          bool
+		progressInterval int
+	)
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	flags.StringVar(&cfgPath, "config", "", "Absolute path of the DuckDB's Jaeger plugin")
+	configFlags := registerConfigFlags(flags)
+	flags.BoolVar(&archive, "archive", false, "Write spans to the archive storage instead of the primary storage")
+	flags.IntVar(&progressInterval, "progress-interval", 1000, "Report progress every N spans")
+	_ = flags.Parse(args)
+
+	logger := newLogger()
+
+	if flags.NArg() == 0 {
+		logger.Error("No files to import")
+		return 1
+	}
+
+	cfg, logger, err := loadConfig(logger, cfgPath, configFlags)
+	if err != nil {
+		return 1
+	}
+
+	store, err := storage.NewStore(logger, cfg, metrics.NullFactory)
+	if err != nil {
+		logger.Error("Failed to create a storage plugin", "error", err)
+		return 1
+	}
+
+	writer := store.SpanWriter()
+	if archive {
+		writer = store.ArchiveSpanWriter()
+	}
+
+	ctx := context.Background()
+	seen := make(map[spanKey]struct{})
+	written, duplicates := 0, 0
+	status := 0
+
+	for _, path := range flags.Args() {
+		data, err := os.ReadFile(filepath.Clean(path))
+		if err != nil {
+			logger.Error("Failed to read file", "file", path, "error", err)
+			status = 1
+			break
+		}
+
+		spans, err := converter.FromJSON(data)
+		if err != nil {
+			logger.Error("Failed to parse file", "file", path, "error", err)
+			status = 1
+			break
+		}
+
+		// Spans are counted once the writer accepted them, the skipped duplicates are counted apart
+		accepted, skipped := 0, 0
+		for _, span := range spans {
+			key := spanKey{traceID: span.TraceID, spanID: span.SpanID}
+			if _, ok := seen[key]; ok {
+				duplicates++
+				skipped++
+				continue
+			}
+			seen[key] = struct{}{}
+
+			if err := writer.WriteSpan(ctx, span); err != nil {
+				logger.Error("Failed to write span", "file", path, "error", err)
+				status = 1
+				break
+			}
+
+			written++
+			accepted++
+			if progressInterval > 0 && written%progressInterval == 0 {
+				logger.Info("Import progress", "spans", written, "duplicates", duplicates)
+			}
+		}
+
+		if status != 0 {
+			break
+		}
+
+		logger.Info("Imported file", "file", path, "spans", accepted, "duplicates", skipped)
+	}
+
+	// The writer batches spans in the background, the batches it failed to write are reported on close
+	if err := store.Close(); err != nil {
+		logger.Error("Failed to write the imported spans", "error", err)
+		return 1
+	}
+
+	if status != 0 {
+		return status
+	}
+
+	logger.Info("Import finished", "spans", written, "duplicates", duplicates)
+
+	return 0
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	hclog "github.com/hashicorp/go-hclog"
+	"github.com/jaegertracing/jaeger/model"
+	uiconv "github.com/jaegertracing/jaeger/model/converter/json"
+	uimodel "github.com/jaegertracing/jaeger/model/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/jaeger-lib/metrics"
+
+	"github.com/chhetripradeep/jaeger-duckdb/storage"
+)
+
+// writeImportFile writes a trace of two spans as Jaeger UI JSON and returns its path
+func writeImportFile(t *testing.T, traceID model.TraceID) string {
+	start := time.Now().Add(-time.Minute).UTC()
+	trace := &model.Trace{Spans: []*model.Span{
+		{TraceID: traceID, SpanID: model.NewSpanID(1), OperationName: "GET /", StartTime: start, Duration: time.Second, Process: model.NewProcess("frontend", nil)},
+		{TraceID: traceID, SpanID: model.NewSpanID(2), OperationName: "SELECT", StartTime: start, Duration: time.Millisecond, Process: model.NewProcess("backend", nil)},
+	}}
+
+	data, err := json.Marshal(uiResponse{Data: []*uimodel.Trace{uiconv.FromDomain(trace)}})
+	require.NoError(t, err)
+
+	path := filepath.Join(t.TempDir(), "trace.json")
+	require.NoError(t, os.WriteFile(path, data, 0o600))
+	return path
+}
+
+func TestRunImport(t *testing.T) {
+	dataFile := filepath.Join(t.TempDir(), "jaeger.db")
+	args := []string{"-datafile", dataFile, "-init-sql-scripts-dir", "../../schema"}
+	traceID := model.NewTraceID(0, 1)
+	path := writeImportFile(t, traceID)
+
+	require.Equal(t, 0, runImport(append(args, path, path)))
+
+	cfg := storage.Configuration{DataFile: dataFile, InitSQLScriptsDir: "../../schema"}
+	store, err := storage.NewStore(hclog.NewNullLogger(), cfg, metrics.NullFactory)
+	require.NoError(t, err)
+	trace, err := store.SpanReader().GetTrace(context.Background(), traceID)
+	require.NoError(t, err)
+	assert.Len(t, trace.Spans, 2)
+	require.NoError(t, store.Close())
+
+	// The batches are written in the background, failing to write them still fails the import
+	assert.Equal(t, 1, runImport(append(args, "-spans-table", "jaeger_missing_spans", path)))
+
+	assert.Equal(t, 1, runImport(append(args, filepath.Join(t.TempDir(), "missing.json"))))
+	assert.Equal(t, 1, runImport(args), "files to import are required")
+}
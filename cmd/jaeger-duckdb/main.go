@@ -2,55 +2,168 @@ package main
 
 import (
 	"flag"
+	"fmt"
 	"os"
-	"path/filepath"
 
 	hclog "github.com/hashicorp/go-hclog"
 	"github.com/jaegertracing/jaeger/plugin/storage/grpc"
 	"github.com/jaegertracing/jaeger/plugin/storage/grpc/shared"
-	yaml "gopkg.in/yaml.v3"
+	"github.com/uber/jaeger-lib/metrics"
 
+	"github.com/chhetripradeep/jaeger-duckdb/otlpreceiver"
 	"github.com/chhetripradeep/jaeger-duckdb/storage"
 )
 
+const loggerName = "jaeger-duckdb"
+
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "export":
+			os.Exit(runExport(os.Args[2:]))
+		case "export-parquet":
+			os.Exit(runExportParquet(os.Args[2:]))
+		case "import":
+			os.Exit(runImport(os.Args[2:]))
+		case "search":
+			os.Exit(runSearch(os.Args[2:]))
+		case "validate":
+			os.Exit(runValidate(os.Args[2:]))
+		}
+	}
+
 	var cfgPath string
 	flag.StringVar(&cfgPath, "config", "", "Absolute path of the DuckDB's Jaeger plugin")
+	configFlags := registerConfigFlags(flag.CommandLine)
 	flag.Parse()
 
-	logger := hclog.New(&hclog.LoggerOptions{
-		Name:       "jaeger-duckdb",
-		Level:      hclog.Trace,
-		JSONFormat: true,
-	})
+	logger := newLogger()
 
-	cfgFile, err := os.ReadFile(filepath.Clean(cfgPath))
+	cfg, logger, err := loadConfig(logger, cfgPath, configFlags)
 	if err != nil {
-		logger.Error("Failed to read config file", "config", cfgPath, "error", err)
 		os.Exit(1)
 	}
 
-	var cfg storage.Configuration
-	err = yaml.Unmarshal(cfgFile, &cfg)
-	if err != nil {
-		logger.Error("Failed to parse config file", "config", cfgPath, "error", err)
-		os.Exit(1)
+	metricsFactory := metrics.NullFactory
+	var admin *adminServer
+	if cfg.AdminHTTPEndpoint != "" {
+		admin = newAdminServer(logger.Named("admin"))
+		metricsFactory = admin.metricsFactory()
 	}
 
 	var pluginServices shared.PluginServices
-	store, err := storage.NewStore(logger, cfg)
+	store, err := storage.NewStore(logger, cfg, metricsFactory)
 	if err != nil {
 		logger.Error("Failed to create a storage plugin", "error", err)
 		os.Exit(1)
 	}
 
+	if admin != nil {
+		admin.registerHealthChecks(store)
+		if cfg.AdminPprof {
+			admin.registerPprof()
+		}
+		if err := admin.start(cfg.AdminHTTPEndpoint); err != nil {
+			logger.Error("Failed to start admin HTTP server", "error", err)
+			os.Exit(1)
+		}
+	}
+
+	receiver, err := startOTLPReceiver(logger, cfg, store)
+	if err != nil {
+		logger.Error("Failed to start OTLP receiver", "error", err)
+		os.Exit(1)
+	}
+
 	pluginServices.Store = store
 	pluginServices.ArchiveStore = store
+	pluginServices.StreamingSpanWriter = store
 
-	grpc.Serve(&pluginServices)
+	// A failed server still stops the receivers and flushes the store before the process exits
+	status := 0
+	if cfg.GRPCServerEndpoint != "" {
+		if err := serveRemote(logger, cfg, &pluginServices); err != nil {
+			logger.Error("Remote storage server failed", "error", err)
+			status = 1
+		}
+	} else {
+		grpc.Serve(&pluginServices)
+	}
+	if receiver != nil {
+		if err := receiver.Close(); err != nil {
+			logger.Error("Failed to stop OTLP receiver", "error", err)
+		}
+	}
+	if admin != nil {
+		if err := admin.Close(); err != nil {
+			logger.Error("Failed to stop admin HTTP server", "error", err)
+		}
+	}
 	err = store.Close()
 	if err != nil {
 		logger.Error("Failed to close store", "error", err)
 		os.Exit(1)
 	}
+	os.Exit(status)
+}
+
+// startOTLPReceiver starts the OTLP endpoints enabled in cfg, it returns nil if none is
+func startOTLPReceiver(logger hclog.Logger, cfg storage.Configuration, store *storage.Store) (*otlpreceiver.Receiver, error) {
+	if cfg.OTLPGRPCEndpoint == "" && cfg.OTLPHTTPEndpoint == "" {
+		return nil, nil
+	}
+
+	receiver := otlpreceiver.NewReceiver(logger.Named("otlp"), store.SpanWriter())
+
+	if cfg.OTLPGRPCEndpoint != "" {
+		if err := receiver.StartGRPC(cfg.OTLPGRPCEndpoint); err != nil {
+			_ = receiver.Close()
+			return nil, err
+		}
+	}
+
+	if cfg.OTLPHTTPEndpoint != "" {
+		if err := receiver.StartHTTP(cfg.OTLPHTTPEndpoint); err != nil {
+			_ = receiver.Close()
+			return nil, err
+		}
+	}
+
+	return receiver, nil
+}
+
+// newLogger returns the logger used until the configuration is loaded
+func newLogger() hclog.Logger {
+	return hclog.New(&hclog.LoggerOptions{
+		Name:       loggerName,
+		Level:      hclog.Info,
+		JSONFormat: true,
+	})
+}
+
+// configuredLogger returns a logger with the level and format set in cfg
+func configuredLogger(cfg storage.Configuration) (hclog.Logger, error) {
+	level := hclog.Info
+	if cfg.LogLevel != "" {
+		level = hclog.LevelFromString(cfg.LogLevel)
+		if level == hclog.NoLevel {
+			return nil, fmt.Errorf("unknown log level %q", cfg.LogLevel)
+		}
+	}
+
+	var jsonFormat bool
+	switch cfg.LogFormat {
+	case "", "json":
+		jsonFormat = true
+	case "text":
+		jsonFormat = false
+	default:
+		return nil, fmt.Errorf("unknown log format %q", cfg.LogFormat)
+	}
+
+	return hclog.New(&hclog.LoggerOptions{
+		Name:       loggerName,
+		Level:      level,
+		JSONFormat: jsonFormat,
+	}), nil
 }
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"io"
+	"os"
+	"time"
+
+	"github.com/chhetripradeep/jaeger-duckdb/storage/duckdbspanstore"
+)
+
+// searchResult is a line of the search results list, read from the trace summaries
+type searchResult struct {
+	TraceID       string    `json:"traceID"`
+	StartTime     time.Time `json:"startTime"`
+	Duration      string    `json:"duration"`
+	RootService   string    `json:"rootService,omitempty"`
+	RootOperation string    `json:"rootOperation,omitempty"`
+	SpanCount     int64     `json:"spanCount"`
+	Services      []string  `json:"services"`
+	ErrorCount    int64     `json:"errorCount"`
+}
+
+// runSearch lists the traces matching a search query from their summaries, without reading their spans
+func runSearch(args []string) int {
+	var (
+		cfgPath     string
+		tags        stringList
+		service     string
+		operation   string
+		start       string
+		end         string
+		durationMin time.Duration
+		durationMax time.Duration
+		limit       int
+	)
+	flags := flag.NewFlagSet("search", flag.ExitOnError)
+	flags.StringVar(&cfgPath, "config", "", "Absolute path of the DuckDB's Jaeger plugin")
+	configFlags := registerConfigFlags(flags)
+	flags.Var(&tags, "tag", "Tag filter as key=value, may be repeated")
+	flags.StringVar(&service, "service", "", "Service name to search for")
+	flags.StringVar(&operation, "operation", "", "Operation name to search for")
+	flags.StringVar(&start, "start", "", "Start of the searched time range (RFC3339), defaults to one hour before end")
+	flags.StringVar(&end, "end", "", "End of the searched time range (RFC3339), defaults to now")
+	flags.DurationVar(&durationMin, "duration-min", 0, "Minimum duration of a matching span, or of the whole trace with search_trace_duration")
+	flags.DurationVar(&durationMax, "duration-max", 0, "Maximum duration of a matching span, or of the whole trace with search_trace_duration")
+	flags.IntVar(&limit, "limit", 20, "Maximum number of traces to search for")
+	_ = flags.Parse(args)
+
+	logger := newLogger()
+
+	if service == "" {
+		logger.Error("A service to search for is required")
+		return 1
+	}
+
+	cfg, logger, err := loadConfig(logger, cfgPath, configFlags)
+	if err != nil {
+		return 1
+	}
+
+	query, err := buildTraceQuery(service, operation, tags, start, end, durationMin, durationMax, limit)
+	if err != nil {
+		logger.Error("Invalid search query", "error", err)
+		return 1
+	}
+
+	store, err := openReadOnlyStore(logger, cfg)
+	if err != nil {
+		logger.Error("Failed to open the data files, the plugin writing to them must be stopped", "error", err)
+		return 1
+	}
+	defer store.Close()
+
+	summaries, err := store.FindTraceSummaries(context.Background(), query)
+	if err != nil {
+		logger.Error("Failed to search traces", "error", err)
+		return 1
+	}
+
+	if err := writeSearchResults(os.Stdout, summaries); err != nil {
+		logger.Error("Failed to write search results", "error", err)
+		return 1
+	}
+
+	return 0
+}
+
+// writeSearchResults writes summaries to out as an indented JSON list of search results
+func writeSearchResults(out io.Writer, summaries []duckdbspanstore.TraceSummary) error {
+	results := make([]searchResult, 0, len(summaries))
+	for _, summary := range summaries {
+		results = append(results, newSearchResult(summary))
+	}
+
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(results)
+}
+
+func newSearchResult(summary duckdbspanstore.TraceSummary) searchResult {
+	services := summary.Services
+	if services == nil {
+		services = []string{}
+	}
+	return searchResult{
+		TraceID:       summary.TraceID.String(),
+		StartTime:     summary.StartTime,
+		Duration:      summary.Duration.String(),
+		RootService:   summary.RootService,
+		RootOperation: summary.RootOperation,
+		SpanCount:     summary.SpanCount,
+		Services:      services,
+		ErrorCount:    summary.ErrorCount,
+	}
+}
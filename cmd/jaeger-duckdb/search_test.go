@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	hclog "github.com/hashicorp/go-hclog"
+	"github.com/jaegertracing/jaeger/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/jaeger-lib/metrics"
+
+	"github.com/chhetripradeep/jaeger-duckdb/storage"
+	"github.com/chhetripradeep/jaeger-duckdb/storage/duckdbspanstore"
+)
+
+func TestNewSearchResult(t *testing.T) {
+	start := time.Date(2022, 1, 1, 10, 0, 0, 0, time.UTC)
+	result := newSearchResult(duckdbspanstore.TraceSummary{
+		TraceID:       model.NewTraceID(0, 1),
+		StartTime:     start,
+		Duration:      1500 * time.Millisecond,
+		RootService:   "frontend",
+		RootOperation: "GET /",
+		SpanCount:     3,
+		Services:      []string{"backend", "frontend"},
+		ErrorCount:    1,
+	})
+	assert.Equal(t, searchResult{
+		TraceID:       "0000000000000001",
+		StartTime:     start,
+		Duration:      "1.5s",
+		RootService:   "frontend",
+		RootOperation: "GET /",
+		SpanCount:     3,
+		Services:      []string{"backend", "frontend"},
+		ErrorCount:    1,
+	}, result)
+
+	// A summary backfilled from the index has no root nor services
+	var buf bytes.Buffer
+	require.NoError(t, writeSearchResults(&buf, []duckdbspanstore.TraceSummary{{TraceID: model.NewTraceID(0, 2), StartTime: start}}))
+	assert.JSONEq(t, `[{"traceID": "0000000000000002", "startTime": "2022-01-01T10:00:00Z", "duration": "0s", "spanCount": 0, "services": [], "errorCount": 0}]`, buf.String())
+
+	buf.Reset()
+	require.NoError(t, writeSearchResults(&buf, nil))
+	assert.JSONEq(t, `[]`, buf.String())
+}
+
+func TestRunSearch(t *testing.T) {
+	cfg := storage.Configuration{
+		DataFile:          filepath.Join(t.TempDir(), "jaeger.db"),
+		SyncWrites:        true,
+		InitSQLScriptsDir: "../../schema",
+	}
+	store, err := storage.NewStore(hclog.NewNullLogger(), cfg, metrics.NullFactory)
+	require.NoError(t, err)
+
+	start := time.Now().Add(-time.Minute).UTC().Truncate(time.Microsecond)
+	for _, span := range []*model.Span{
+		{SpanID: model.NewSpanID(1), OperationName: "GET /", Process: model.NewProcess("frontend", nil)},
+		{SpanID: model.NewSpanID(2), OperationName: "SELECT", Process: model.NewProcess("backend", nil), References: []model.SpanRef{model.NewChildOfRef(model.NewTraceID(0, 1), model.NewSpanID(1))}},
+	} {
+		span.TraceID = model.NewTraceID(0, 1)
+		span.StartTime = start
+		span.Duration = time.Second
+		require.NoError(t, store.SpanWriter().WriteSpan(context.Background(), span))
+	}
+	require.NoError(t, store.Close())
+
+	// The search results are written to stdout
+	output, err := os.Create(filepath.Join(t.TempDir(), "results.json"))
+	require.NoError(t, err)
+	defer output.Close()
+	stdout := os.Stdout
+	os.Stdout = output
+	defer func() { os.Stdout = stdout }()
+
+	args := []string{"-datafile", cfg.DataFile, "-init-sql-scripts-dir", cfg.InitSQLScriptsDir}
+	require.Equal(t, 0, runSearch(append(args, "-service", "backend")))
+
+	var results []searchResult
+	data, err := os.ReadFile(output.Name())
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(data, &results))
+	require.Len(t, results, 1)
+	assert.Equal(t, "0000000000000001", results[0].TraceID)
+	assert.Equal(t, "frontend", results[0].RootService)
+	assert.Equal(t, int64(2), results[0].SpanCount)
+	assert.Equal(t, []string{"backend", "frontend"}, results[0].Services)
+
+	assert.Equal(t, 1, runSearch(args), "a service is required")
+	assert.Equal(t, 1, runSearch(append(args, "-service", "backend", "-tag", "error")), "tags are key=value pairs")
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+
+	hclog "github.com/hashicorp/go-hclog"
+	"github.com/jaegertracing/jaeger/plugin/storage/grpc/shared"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+
+	"github.com/chhetripradeep/jaeger-duckdb/storage"
+)
+
+var errTLSCertRequired = errors.New("tls cert and key are required when tls is enabled")
+
+// serveRemote serves the storage plugin services over TCP so that Jaeger can use the
+// plugin as a remote storage backend. It blocks until SIGINT or SIGTERM is received.
+func serveRemote(logger hclog.Logger, cfg storage.Configuration, services *shared.PluginServices) error {
+	var opts []grpc.ServerOption
+	if cfg.GRPCServerTLSEnabled {
+		tlsConfig, err := serverTLSConfig(cfg)
+		if err != nil {
+			return err
+		}
+		opts = append(opts, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	}
+
+	server := grpc.NewServer(opts...)
+	handler := shared.NewGRPCHandlerWithPlugins(services.Store, services.ArchiveStore, services.StreamingSpanWriter)
+	if err := handler.Register(server); err != nil {
+		return err
+	}
+
+	listener, err := net.Listen("tcp", cfg.GRPCServerEndpoint)
+	if err != nil {
+		return fmt.Errorf("could not listen on %s: %w", cfg.GRPCServerEndpoint, err)
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	go func() {
+		sig := <-signals
+		logger.Info("Stopping remote storage server", "signal", sig.String())
+		server.GracefulStop()
+	}()
+
+	logger.Info("Starting remote storage server", "endpoint", cfg.GRPCServerEndpoint, "tls", cfg.GRPCServerTLSEnabled)
+
+	return server.Serve(listener)
+}
+
+func serverTLSConfig(cfg storage.Configuration) (*tls.Config, error) {
+	if cfg.GRPCServerTLSCert == "" || cfg.GRPCServerTLSKey == "" {
+		return nil, errTLSCertRequired
+	}
+
+	certificate, err := tls.LoadX509KeyPair(cfg.GRPCServerTLSCert, cfg.GRPCServerTLSKey)
+	if err != nil {
+		return nil, fmt.Errorf("could not load tls certificate: %w", err)
+	}
+
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{certificate},
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	if cfg.GRPCServerTLSClientCA != "" {
+		ca, err := os.ReadFile(filepath.Clean(cfg.GRPCServerTLSClientCA))
+		if err != nil {
+			return nil, fmt.Errorf("could not read tls client ca: %w", err)
+		}
+
+		clientCAs := x509.NewCertPool()
+		if !clientCAs.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("no certificates found in %s", cfg.GRPCServerTLSClientCA)
+		}
+
+		tlsConfig.ClientCAs = clientCAs
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return tlsConfig, nil
+}
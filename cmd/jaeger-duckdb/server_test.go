@@ -0,0 +1,112 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/chhetripradeep/jaeger-duckdb/storage"
+)
+
+// writeTestCertificate writes a self-signed certificate and its key to dir and returns their paths
+func writeTestCertificate(t *testing.T, dir string) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "localhost"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	certPath := filepath.Join(dir, "cert.pem")
+	keyPath := filepath.Join(dir, "key.pem")
+	require.NoError(t, os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+	require.NoError(t, os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600))
+
+	return certPath, keyPath
+}
+
+func TestServerTLSConfig(t *testing.T) {
+	dir := t.TempDir()
+	certPath, keyPath := writeTestCertificate(t, dir)
+	emptyCA := filepath.Join(dir, "empty.pem")
+	require.NoError(t, os.WriteFile(emptyCA, []byte("no certificates here"), 0o600))
+
+	tests := []struct {
+		name       string
+		cfg        storage.Configuration
+		err        string
+		clientAuth tls.ClientAuthType
+	}{
+		{
+			name: "missing cert",
+			cfg:  storage.Configuration{GRPCServerTLSKey: keyPath},
+			err:  errTLSCertRequired.Error(),
+		},
+		{
+			name: "missing key",
+			cfg:  storage.Configuration{GRPCServerTLSCert: certPath},
+			err:  errTLSCertRequired.Error(),
+		},
+		{
+			name: "unreadable key",
+			cfg:  storage.Configuration{GRPCServerTLSCert: certPath, GRPCServerTLSKey: filepath.Join(dir, "missing.pem")},
+			err:  "could not load tls certificate",
+		},
+		{
+			name:       "server certificate only",
+			cfg:        storage.Configuration{GRPCServerTLSCert: certPath, GRPCServerTLSKey: keyPath},
+			clientAuth: tls.NoClientCert,
+		},
+		{
+			name:       "client ca",
+			cfg:        storage.Configuration{GRPCServerTLSCert: certPath, GRPCServerTLSKey: keyPath, GRPCServerTLSClientCA: certPath},
+			clientAuth: tls.RequireAndVerifyClientCert,
+		},
+		{
+			name: "missing client ca",
+			cfg:  storage.Configuration{GRPCServerTLSCert: certPath, GRPCServerTLSKey: keyPath, GRPCServerTLSClientCA: filepath.Join(dir, "missing.pem")},
+			err:  "could not read tls client ca",
+		},
+		{
+			name: "client ca without certificates",
+			cfg:  storage.Configuration{GRPCServerTLSCert: certPath, GRPCServerTLSKey: keyPath, GRPCServerTLSClientCA: emptyCA},
+			err:  "no certificates found in " + emptyCA,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tlsConfig, err := serverTLSConfig(test.cfg)
+			if test.err != "" {
+				assert.ErrorContains(t, err, test.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Len(t, tlsConfig.Certificates, 1)
+			assert.Equal(t, uint16(tls.VersionTLS12), tlsConfig.MinVersion)
+			assert.Equal(t, test.clientAuth, tlsConfig.ClientAuth)
+			assert.Equal(t, test.clientAuth == tls.RequireAndVerifyClientCert, tlsConfig.ClientCAs != nil)
+		})
+	}
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"flag"
+	"os"
+
+	yaml "gopkg.in/yaml.v3"
+)
+
+// runValidate prints the configuration that results from the config file, the environment and the flags,
+// and fails if it is invalid
+func runValidate(args []string) int {
+	var cfgPath string
+	flags := flag.NewFlagSet("validate", flag.ExitOnError)
+	flags.StringVar(&cfgPath, "config", "", "Absolute path of the DuckDB's Jaeger plugin")
+	configFlags := registerConfigFlags(flags)
+	_ = flags.Parse(args)
+
+	logger := newLogger()
+
+	cfg, logger, err := loadConfig(logger, cfgPath, configFlags)
+	if err != nil {
+		return 1
+	}
+
+	encoder := yaml.NewEncoder(os.Stdout)
+	defer encoder.Close()
+	if err := encoder.Encode(cfg); err != nil {
+		logger.Error("Failed to print config", "error", err)
+		return 1
+	}
+
+	if err := cfg.Validate(); err != nil {
+		logger.Error("Invalid config", "error", err)
+		return 1
+	}
+
+	return 0
+}
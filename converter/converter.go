@@ -0,0 +1,22 @@
+// Package converter translates trace files and OTLP payloads into Jaeger's domain model
+package converter
+
+import (
+	"encoding/json"
+
+	"github.com/jaegertracing/jaeger/model"
+)
+
+// FromJSON converts either an OTLP/JSON document or a Jaeger UI export to Jaeger spans
+func FromJSON(data []byte) ([]*model.Span, error) {
+	var envelope map[string]json.RawMessage
+	if err := json.Unmarshal(data, &envelope); err == nil {
+		_, camel := envelope["resourceSpans"]
+		_, snake := envelope["resource_spans"]
+		if camel || snake {
+			return FromOTLPJSON(data)
+		}
+	}
+
+	return FromJaegerJSON(data)
+}
@@ -0,0 +1,204 @@
+package converter
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/jaegertracing/jaeger/model"
+	uiconv "github.com/jaegertracing/jaeger/model/converter/json"
+	uimodel "github.com/jaegertracing/jaeger/model/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	oteltrace "go.opentelemetry.io/otel/trace"
+)
+
+func TestFromJSON_JaegerUI(t *testing.T) {
+	traceID := model.NewTraceID(1, 2)
+	startTime := time.Date(2022, 8, 28, 2, 45, 40, 123000, time.UTC)
+	trace := &model.Trace{
+		Spans: []*model.Span{
+			{
+				TraceID:       traceID,
+				SpanID:        model.NewSpanID(3),
+				OperationName: "GET /customer",
+				StartTime:     startTime,
+				Duration:      time.Millisecond,
+				Tags: []model.KeyValue{
+					model.String("http.method", "GET"),
+					model.Int64("http.status_code", 9007199254740993),
+					model.Bool("error", true),
+					model.Float64("ratio", 0.5),
+					model.Binary("payload", []byte{0x01, 0x02}),
+				},
+				Logs: []model.Log{
+					{Timestamp: startTime, Fields: []model.KeyValue{model.String("event", "retry")}},
+				},
+				Process: model.NewProcess("customer", []model.KeyValue{model.String("hostname", "host-1")}),
+			},
+			{
+				TraceID:       traceID,
+				SpanID:        model.NewSpanID(4),
+				OperationName: "SQL SELECT",
+				References:    []model.SpanRef{model.NewChildOfRef(traceID, model.NewSpanID(3))},
+				StartTime:     startTime.Add(time.Microsecond),
+				Duration:      time.Microsecond * 500,
+				Process:       model.NewProcess("mysql", nil),
+			},
+		},
+	}
+
+	data, err := json.Marshal(map[string]interface{}{"data": []*uimodel.Trace{uiconv.FromDomain(trace)}})
+	require.NoError(t, err)
+
+	spans, err := FromJSON(data)
+	require.NoError(t, err)
+	require.Len(t, spans, 2)
+
+	assert.Equal(t, trace.Spans[0].Tags, spans[0].Tags)
+	assert.Equal(t, trace.Spans[0].Logs, spans[0].Logs)
+	assert.Equal(t, trace.Spans[0].Process, spans[0].Process)
+	assert.Equal(t, trace.Spans[0].StartTime, spans[0].StartTime)
+	assert.Equal(t, trace.Spans[1].References, spans[1].References)
+	assert.Equal(t, trace.Spans[1].Duration, spans[1].Duration)
+	assert.Equal(t, "mysql", spans[1].Process.ServiceName)
+}
+
+func TestFromJSON_OTLP(t *testing.T) {
+	data := []byte(`{
+	  "resourceSpans": [{
+	    "resource": {"attributes": [
+	      {"key": "service.name", "value": {"stringValue": "frontend"}},
+	      {"key": "host.name", "value": {"stringValue": "host-1"}}
+	    ]},
+	    "scopeSpans": [{
+	      "scope": {"name": "otel-go", "version": "1.11.2"},
+	      "spans": [{
+	        "traceId": "5b8efff798038103d269b633813fc60c",
+	        "spanId": "eee19b7ec3c1b174",
+	        "parentSpanId": "eee19b7ec3c1b173",
+	        "name": "HTTP GET",
+	        "kind": 2,
+	        "startTimeUnixNano": "1544712660000000000",
+	        "endTimeUnixNano": "1544712661000000000",
+	        "attributes": [
+	          {"key": "http.status_code", "value": {"intValue": "500"}},
+	          {"key": "http.routes", "value": {"arrayValue": {"values": [{"stringValue": "/a"}]}}}
+	        ],
+	        "events": [{"timeUnixNano": "1544712660500000000", "name": "retry"}],
+	        "status": {"code": 2, "message": "boom"}
+	      }]
+	    }]
+	  }]
+	}`)
+
+	spans, err := FromJSON(data)
+	require.NoError(t, err)
+	require.Len(t, spans, 1)
+
+	span := spans[0]
+	traceID, err := model.TraceIDFromString("5b8efff798038103d269b633813fc60c")
+	require.NoError(t, err)
+
+	assert.Equal(t, traceID, span.TraceID)
+	assert.Equal(t, "eee19b7ec3c1b174", span.SpanID.String())
+	assert.Equal(t, "eee19b7ec3c1b173", span.ParentSpanID().String())
+	assert.Equal(t, "HTTP GET", span.OperationName)
+	assert.Equal(t, time.Second, span.Duration)
+	assert.Equal(t, "frontend", span.Process.ServiceName)
+	assert.Equal(t, []model.KeyValue{model.String("host.name", "host-1")}, span.Process.Tags)
+	assert.Equal(t, []model.KeyValue{
+		model.Int64("http.status_code", 500),
+		model.String("http.routes", `["/a"]`),
+		model.String("span.kind", "server"),
+		model.Bool("error", true),
+		model.String("otel.status_code", "ERROR"),
+		model.String("otel.status_description", "boom"),
+		model.String("otel.library.name", "otel-go"),
+		model.String("otel.library.version", "1.11.2"),
+	}, span.Tags)
+	require.Len(t, span.Logs, 1)
+	assert.Equal(t, []model.KeyValue{model.String("event", "retry")}, span.Logs[0].Fields)
+}
+
+func TestFromJSON_OTLP_numericTimestamps(t *testing.T) {
+	data := []byte(`{
+	  "resourceSpans": [{
+	    "resource": {"attributes": [{"key": "service.name", "value": {"stringValue": "frontend"}}]},
+	    "scopeSpans": [{
+	      "spans": [{
+	        "traceId": "5b8efff798038103d269b633813fc60c",
+	        "spanId": "eee19b7ec3c1b174",
+	        "name": "HTTP GET",
+	        "startTimeUnixNano": 1700000000123456789,
+	        "endTimeUnixNano": 1700000001123457789,
+	        "attributes": [{"key": "big", "value": {"intValue": 9007199254740993}}],
+	        "events": [{"timeUnixNano": 1700000000223456789, "name": "retry"}]
+	      }]
+	    }]
+	  }]
+	}`)
+
+	spans, err := FromJSON(data)
+	require.NoError(t, err)
+	require.Len(t, spans, 1)
+
+	span := spans[0]
+	assert.Equal(t, time.Unix(0, 1700000000123456789).UTC(), span.StartTime.UTC())
+	assert.Equal(t, time.Second+time.Microsecond, span.Duration)
+	require.Len(t, span.Logs, 1)
+	assert.Equal(t, time.Unix(0, 1700000000223456789).UTC(), span.Logs[0].Timestamp.UTC())
+	assert.Contains(t, span.Tags, model.Int64("big", 9007199254740993))
+}
+
+func TestFromOTelSpans(t *testing.T) {
+	startTime := time.Date(2022, 8, 28, 2, 45, 40, 0, time.UTC)
+	traceID := oteltrace.TraceID{0x5b, 0x8e, 0xff, 0xf7, 0x98, 0x03, 0x81, 0x03, 0xd2, 0x69, 0xb6, 0x33, 0x81, 0x3f, 0xc6, 0x0c}
+
+	stub := tracetest.SpanStub{
+		Name: "flush",
+		SpanContext: oteltrace.NewSpanContext(oteltrace.SpanContextConfig{
+			TraceID: traceID,
+			SpanID:  oteltrace.SpanID{0xee, 0xe1, 0x9b, 0x7e, 0xc3, 0xc1, 0xb1, 0x74},
+		}),
+		Parent: oteltrace.NewSpanContext(oteltrace.SpanContextConfig{
+			TraceID: traceID,
+			SpanID:  oteltrace.SpanID{0xee, 0xe1, 0x9b, 0x7e, 0xc3, 0xc1, 0xb1, 0x73},
+		}),
+		SpanKind:  oteltrace.SpanKindInternal,
+		StartTime: startTime,
+		EndTime:   startTime.Add(time.Millisecond),
+		Attributes: []attribute.KeyValue{
+			attribute.String("db.system", "duckdb"),
+			attribute.Int("batch.size", 10),
+		},
+		Status:   sdktrace.Status{Code: codes.Error, Description: "boom"},
+		Resource: resource.NewSchemaless(attribute.String("service.name", "jaeger-duckdb")),
+	}
+
+	spans, err := FromOTelSpans([]sdktrace.ReadOnlySpan{stub.Snapshot()})
+	require.NoError(t, err)
+	require.Len(t, spans, 1)
+
+	span := spans[0]
+	assert.Equal(t, "5b8efff798038103d269b633813fc60c", span.TraceID.String())
+	assert.Equal(t, "eee19b7ec3c1b174", span.SpanID.String())
+	assert.Equal(t, "eee19b7ec3c1b173", span.ParentSpanID().String())
+	assert.Equal(t, "flush", span.OperationName)
+	assert.Equal(t, startTime, span.StartTime)
+	assert.Equal(t, time.Millisecond, span.Duration)
+	assert.Equal(t, "jaeger-duckdb", span.Process.ServiceName)
+	assert.Equal(t, []model.KeyValue{
+		model.String("db.system", "duckdb"),
+		model.Int64("batch.size", 10),
+		model.String("span.kind", "internal"),
+		model.Bool("error", true),
+		model.String("otel.status_code", "ERROR"),
+		model.String("otel.status_description", "boom"),
+	}, span.Tags)
+}
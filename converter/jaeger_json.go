@@ -0,0 +1,246 @@
+package converter
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/jaegertracing/jaeger/model"
+	uimodel "github.com/jaegertracing/jaeger/model/json"
+)
+
+// uiResponse is the envelope used by the Jaeger UI for search results and JSON downloads
+type uiResponse struct {
+	Data []uimodel.Trace `json:"data"`
+}
+
+// UnmarshalJaegerJSON decodes traces exported from the Jaeger UI. It accepts the
+// {"data": [...]} envelope, a bare list of traces or a single trace.
+func UnmarshalJaegerJSON(data []byte) ([]uimodel.Trace, error) {
+	data = bytes.TrimSpace(data)
+
+	if len(data) > 0 && data[0] == '[' {
+		var traces []uimodel.Trace
+		if err := unmarshalUseNumber(data, &traces); err != nil {
+			return nil, err
+		}
+		return traces, nil
+	}
+
+	var envelope map[string]json.RawMessage
+	if err := json.Unmarshal(data, &envelope); err != nil {
+		return nil, err
+	}
+
+	if _, ok := envelope["data"]; ok {
+		var response uiResponse
+		if err := unmarshalUseNumber(data, &response); err != nil {
+			return nil, err
+		}
+		return response.Data, nil
+	}
+
+	var trace uimodel.Trace
+	if err := unmarshalUseNumber(data, &trace); err != nil {
+		return nil, err
+	}
+	return []uimodel.Trace{trace}, nil
+}
+
+// unmarshalUseNumber keeps tag values as json.Number so that large int64 values survive
+func unmarshalUseNumber(data []byte, v interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	return decoder.Decode(v)
+}
+
+// FromJaegerJSON converts traces exported from the Jaeger UI to Jaeger spans
+func FromJaegerJSON(data []byte) ([]*model.Span, error) {
+	traces, err := UnmarshalJaegerJSON(data)
+	if err != nil {
+		return nil, err
+	}
+
+	spans := make([]*model.Span, 0)
+	for i := range traces {
+		for j := range traces[i].Spans {
+			span, err := fromUISpan(&traces[i].Spans[j], traces[i].Processes)
+			if err != nil {
+				return nil, err
+			}
+			spans = append(spans, span)
+		}
+	}
+
+	return spans, nil
+}
+
+func fromUISpan(s *uimodel.Span, processes map[uimodel.ProcessID]uimodel.Process) (*model.Span, error) {
+	traceID, err := model.TraceIDFromString(string(s.TraceID))
+	if err != nil {
+		return nil, err
+	}
+
+	spanID, err := model.SpanIDFromString(string(s.SpanID))
+	if err != nil {
+		return nil, err
+	}
+
+	span := &model.Span{
+		TraceID:       traceID,
+		SpanID:        spanID,
+		OperationName: s.OperationName,
+		Flags:         model.Flags(s.Flags),
+		StartTime:     model.EpochMicrosecondsAsTime(s.StartTime),
+		Duration:      model.MicrosecondsAsDuration(s.Duration),
+		Warnings:      s.Warnings,
+	}
+
+	for _, ref := range s.References {
+		spanRef, err := fromUIReference(ref)
+		if err != nil {
+			return nil, err
+		}
+		span.References = append(span.References, spanRef)
+	}
+
+	if len(span.References) == 0 && s.ParentSpanID != "" {
+		parentSpanID, err := model.SpanIDFromString(string(s.ParentSpanID))
+		if err != nil {
+			return nil, err
+		}
+		span.References = append(span.References, model.NewChildOfRef(traceID, parentSpanID))
+	}
+
+	if span.Tags, err = fromUIKeyValues(s.Tags); err != nil {
+		return nil, err
+	}
+
+	for _, l := range s.Logs {
+		fields, err := fromUIKeyValues(l.Fields)
+		if err != nil {
+			return nil, err
+		}
+		span.Logs = append(span.Logs, model.Log{
+			Timestamp: model.EpochMicrosecondsAsTime(l.Timestamp),
+			Fields:    fields,
+		})
+	}
+
+	process := s.Process
+	if process == nil {
+		p, ok := processes[s.ProcessID]
+		if !ok {
+			return nil, fmt.Errorf("span %s references unknown process %q", s.SpanID, s.ProcessID)
+		}
+		process = &p
+	}
+
+	processTags, err := fromUIKeyValues(process.Tags)
+	if err != nil {
+		return nil, err
+	}
+	span.Process = model.NewProcess(process.ServiceName, processTags)
+
+	return span, nil
+}
+
+func fromUIReference(ref uimodel.Reference) (model.SpanRef, error) {
+	traceID, err := model.TraceIDFromString(string(ref.TraceID))
+	if err != nil {
+		return model.SpanRef{}, err
+	}
+
+	spanID, err := model.SpanIDFromString(string(ref.SpanID))
+	if err != nil {
+		return model.SpanRef{}, err
+	}
+
+	switch ref.RefType {
+	case uimodel.ChildOf:
+		return model.NewChildOfRef(traceID, spanID), nil
+	case uimodel.FollowsFrom:
+		return model.NewFollowsFromRef(traceID, spanID), nil
+	default:
+		return model.SpanRef{}, fmt.Errorf("unknown reference type %q", ref.RefType)
+	}
+}
+
+func fromUIKeyValues(keyValues []uimodel.KeyValue) ([]model.KeyValue, error) {
+	if len(keyValues) == 0 {
+		return nil, nil
+	}
+
+	result := make([]model.KeyValue, 0, len(keyValues))
+	for _, kv := range keyValues {
+		converted, err := fromUIKeyValue(kv)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, converted)
+	}
+
+	return result, nil
+}
+
+func fromUIKeyValue(kv uimodel.KeyValue) (model.KeyValue, error) {
+	switch kv.Type {
+	case uimodel.StringType, "":
+		return model.String(kv.Key, fmt.Sprint(kv.Value)), nil
+	case uimodel.BoolType:
+		switch v := kv.Value.(type) {
+		case bool:
+			return model.Bool(kv.Key, v), nil
+		case string:
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return model.KeyValue{}, fmt.Errorf("invalid bool value for tag %q: %w", kv.Key, err)
+			}
+			return model.Bool(kv.Key, b), nil
+		}
+	case uimodel.Int64Type:
+		switch v := kv.Value.(type) {
+		case json.Number:
+			i, err := v.Int64()
+			if err != nil {
+				return model.KeyValue{}, fmt.Errorf("invalid int64 value for tag %q: %w", kv.Key, err)
+			}
+			return model.Int64(kv.Key, i), nil
+		case string:
+			i, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				return model.KeyValue{}, fmt.Errorf("invalid int64 value for tag %q: %w", kv.Key, err)
+			}
+			return model.Int64(kv.Key, i), nil
+		}
+	case uimodel.Float64Type:
+		switch v := kv.Value.(type) {
+		case json.Number:
+			f, err := v.Float64()
+			if err != nil {
+				return model.KeyValue{}, fmt.Errorf("invalid float64 value for tag %q: %w", kv.Key, err)
+			}
+			return model.Float64(kv.Key, f), nil
+		case string:
+			f, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				return model.KeyValue{}, fmt.Errorf("invalid float64 value for tag %q: %w", kv.Key, err)
+			}
+			return model.Float64(kv.Key, f), nil
+		}
+	case uimodel.BinaryType:
+		if v, ok := kv.Value.(string); ok {
+			b, err := base64.StdEncoding.DecodeString(v)
+			if err != nil {
+				return model.KeyValue{}, fmt.Errorf("invalid binary value for tag %q: %w", kv.Key, err)
+			}
+			return model.Binary(kv.Key, b), nil
+		}
+	default:
+		return model.KeyValue{}, fmt.Errorf("unknown type %q for tag %q", kv.Type, kv.Key)
+	}
+
+	return model.KeyValue{}, fmt.Errorf("invalid %s value for tag %q: %v", kv.Type, kv.Key, kv.Value)
+}
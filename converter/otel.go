@@ -0,0 +1,141 @@
+package converter
+
+import (
+	"github.com/jaegertracing/jaeger/model"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// FromOTelSpans converts spans recorded by the OpenTelemetry SDK to Jaeger spans
+func FromOTelSpans(otelSpans []sdktrace.ReadOnlySpan) ([]*model.Span, error) {
+	spans := make([]*model.Span, 0, len(otelSpans))
+
+	for _, s := range otelSpans {
+		span, err := fromOTelSpan(s)
+		if err != nil {
+			return nil, err
+		}
+		spans = append(spans, span)
+	}
+
+	return spans, nil
+}
+
+func fromOTelSpan(s sdktrace.ReadOnlySpan) (*model.Span, error) {
+	traceIDBytes := s.SpanContext().TraceID()
+	traceID, err := model.TraceIDFromBytes(traceIDBytes[:])
+	if err != nil {
+		return nil, err
+	}
+
+	spanIDBytes := s.SpanContext().SpanID()
+	spanID, err := model.SpanIDFromBytes(spanIDBytes[:])
+	if err != nil {
+		return nil, err
+	}
+
+	span := &model.Span{
+		TraceID:       traceID,
+		SpanID:        spanID,
+		OperationName: s.Name(),
+		Flags:         model.SampledFlag,
+		StartTime:     s.StartTime().UTC(),
+		Duration:      s.EndTime().Sub(s.StartTime()),
+		Process:       processFromOTelResource(s),
+	}
+
+	if s.Parent().IsValid() {
+		parentSpanIDBytes := s.Parent().SpanID()
+		parentSpanID, err := model.SpanIDFromBytes(parentSpanIDBytes[:])
+		if err != nil {
+			return nil, err
+		}
+		span.References = append(span.References, model.NewChildOfRef(traceID, parentSpanID))
+	}
+
+	for _, link := range s.Links() {
+		linkTraceIDBytes := link.SpanContext.TraceID()
+		linkTraceID, err := model.TraceIDFromBytes(linkTraceIDBytes[:])
+		if err != nil {
+			return nil, err
+		}
+		linkSpanIDBytes := link.SpanContext.SpanID()
+		linkSpanID, err := model.SpanIDFromBytes(linkSpanIDBytes[:])
+		if err != nil {
+			return nil, err
+		}
+		span.References = append(span.References, model.NewFollowsFromRef(linkTraceID, linkSpanID))
+	}
+
+	for _, kv := range s.Attributes() {
+		span.Tags = append(span.Tags, otelKeyValue(kv))
+	}
+
+	if kind := s.SpanKind(); kind != trace.SpanKindUnspecified {
+		span.Tags = append(span.Tags, model.String("span.kind", kind.String()))
+	}
+
+	switch s.Status().Code {
+	case codes.Error:
+		span.Tags = append(span.Tags, model.Bool("error", true), model.String("otel.status_code", "ERROR"))
+	case codes.Ok:
+		span.Tags = append(span.Tags, model.String("otel.status_code", "OK"))
+	}
+
+	if description := s.Status().Description; description != "" {
+		span.Tags = append(span.Tags, model.String("otel.status_description", description))
+	}
+
+	if scope := s.InstrumentationScope(); scope.Name != "" {
+		span.Tags = append(span.Tags, model.String("otel.library.name", scope.Name))
+		if scope.Version != "" {
+			span.Tags = append(span.Tags, model.String("otel.library.version", scope.Version))
+		}
+	}
+
+	for _, event := range s.Events() {
+		log := model.Log{Timestamp: event.Time.UTC()}
+		if event.Name != "" {
+			log.Fields = append(log.Fields, model.String("event", event.Name))
+		}
+		for _, kv := range event.Attributes {
+			log.Fields = append(log.Fields, otelKeyValue(kv))
+		}
+		span.Logs = append(span.Logs, log)
+	}
+
+	return span, nil
+}
+
+func processFromOTelResource(s sdktrace.ReadOnlySpan) *model.Process {
+	process := &model.Process{ServiceName: unknownServiceName}
+
+	for _, kv := range s.Resource().Attributes() {
+		if string(kv.Key) == serviceNameAttribute {
+			process.ServiceName = kv.Value.AsString()
+			continue
+		}
+		process.Tags = append(process.Tags, otelKeyValue(kv))
+	}
+
+	return process
+}
+
+func otelKeyValue(kv attribute.KeyValue) model.KeyValue {
+	key := string(kv.Key)
+
+	switch kv.Value.Type() {
+	case attribute.STRING:
+		return model.String(key, kv.Value.AsString())
+	case attribute.BOOL:
+		return model.Bool(key, kv.Value.AsBool())
+	case attribute.INT64:
+		return model.Int64(key, kv.Value.AsInt64())
+	case attribute.FLOAT64:
+		return model.Float64(key, kv.Value.AsFloat64())
+	default:
+		return model.String(key, kv.Value.Emit())
+	}
+}
@@ -0,0 +1,216 @@
+package converter
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/jaegertracing/jaeger/model"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+)
+
+const (
+	serviceNameAttribute = "service.name"
+	unknownServiceName   = "unknown_service"
+)
+
+// FromOTLP converts OTLP resource spans to Jaeger spans
+func FromOTLP(resourceSpans []*tracepb.ResourceSpans) ([]*model.Span, error) {
+	spans := make([]*model.Span, 0)
+
+	for _, rs := range resourceSpans {
+		process := processFromResource(rs.GetResource())
+
+		for _, ss := range rs.GetScopeSpans() {
+			scopeTags := scopeTags(ss.GetScope())
+
+			for _, s := range ss.GetSpans() {
+				span, err := fromOTLPSpan(s, process, scopeTags)
+				if err != nil {
+					return nil, err
+				}
+				spans = append(spans, span)
+			}
+		}
+	}
+
+	return spans, nil
+}
+
+func processFromResource(resource *resourcepb.Resource) *model.Process {
+	process := &model.Process{ServiceName: unknownServiceName}
+
+	for _, attribute := range resource.GetAttributes() {
+		if attribute.GetKey() == serviceNameAttribute {
+			process.ServiceName = attribute.GetValue().GetStringValue()
+			continue
+		}
+		process.Tags = append(process.Tags, keyValue(attribute))
+	}
+
+	return process
+}
+
+func scopeTags(scope *commonpb.InstrumentationScope) []model.KeyValue {
+	var tags []model.KeyValue
+	if scope.GetName() != "" {
+		tags = append(tags, model.String("otel.library.name", scope.GetName()))
+	}
+	if scope.GetVersion() != "" {
+		tags = append(tags, model.String("otel.library.version", scope.GetVersion()))
+	}
+	return tags
+}
+
+func fromOTLPSpan(s *tracepb.Span, process *model.Process, scopeTags []model.KeyValue) (*model.Span, error) {
+	traceID, err := model.TraceIDFromBytes(s.GetTraceId())
+	if err != nil {
+		return nil, err
+	}
+
+	spanID, err := model.SpanIDFromBytes(s.GetSpanId())
+	if err != nil {
+		return nil, err
+	}
+
+	startTime := time.Unix(0, int64(s.GetStartTimeUnixNano())).UTC()
+	endTime := time.Unix(0, int64(s.GetEndTimeUnixNano())).UTC()
+
+	span := &model.Span{
+		TraceID:       traceID,
+		SpanID:        spanID,
+		OperationName: s.GetName(),
+		Flags:         model.SampledFlag,
+		StartTime:     startTime,
+		Duration:      endTime.Sub(startTime),
+		Process:       process,
+	}
+
+	if len(s.GetParentSpanId()) > 0 {
+		parentSpanID, err := model.SpanIDFromBytes(s.GetParentSpanId())
+		if err != nil {
+			return nil, err
+		}
+		span.References = append(span.References, model.NewChildOfRef(traceID, parentSpanID))
+	}
+
+	for _, link := range s.GetLinks() {
+		linkTraceID, err := model.TraceIDFromBytes(link.GetTraceId())
+		if err != nil {
+			return nil, err
+		}
+		linkSpanID, err := model.SpanIDFromBytes(link.GetSpanId())
+		if err != nil {
+			return nil, err
+		}
+		span.References = append(span.References, model.NewFollowsFromRef(linkTraceID, linkSpanID))
+	}
+
+	for _, attribute := range s.GetAttributes() {
+		span.Tags = append(span.Tags, keyValue(attribute))
+	}
+
+	if kind := spanKind(s.GetKind()); kind != "" {
+		span.Tags = append(span.Tags, model.String("span.kind", kind))
+	}
+
+	switch s.GetStatus().GetCode() {
+	case tracepb.Status_STATUS_CODE_ERROR:
+		span.Tags = append(span.Tags, model.Bool("error", true), model.String("otel.status_code", "ERROR"))
+	case tracepb.Status_STATUS_CODE_OK:
+		span.Tags = append(span.Tags, model.String("otel.status_code", "OK"))
+	}
+
+	if message := s.GetStatus().GetMessage(); message != "" {
+		span.Tags = append(span.Tags, model.String("otel.status_description", message))
+	}
+
+	span.Tags = append(span.Tags, scopeTags...)
+
+	for _, event := range s.GetEvents() {
+		log := model.Log{
+			Timestamp: time.Unix(0, int64(event.GetTimeUnixNano())).UTC(),
+		}
+		if event.GetName() != "" {
+			log.Fields = append(log.Fields, model.String("event", event.GetName()))
+		}
+		for _, attribute := range event.GetAttributes() {
+			log.Fields = append(log.Fields, keyValue(attribute))
+		}
+		span.Logs = append(span.Logs, log)
+	}
+
+	return span, nil
+}
+
+func spanKind(kind tracepb.Span_SpanKind) string {
+	switch kind {
+	case tracepb.Span_SPAN_KIND_CLIENT:
+		return "client"
+	case tracepb.Span_SPAN_KIND_SERVER:
+		return "server"
+	case tracepb.Span_SPAN_KIND_PRODUCER:
+		return "producer"
+	case tracepb.Span_SPAN_KIND_CONSUMER:
+		return "consumer"
+	case tracepb.Span_SPAN_KIND_INTERNAL:
+		return "internal"
+	default:
+		return ""
+	}
+}
+
+func keyValue(attribute *commonpb.KeyValue) model.KeyValue {
+	key := attribute.GetKey()
+	value := attribute.GetValue()
+
+	switch v := value.GetValue().(type) {
+	case *commonpb.AnyValue_StringValue:
+		return model.String(key, v.StringValue)
+	case *commonpb.AnyValue_BoolValue:
+		return model.Bool(key, v.BoolValue)
+	case *commonpb.AnyValue_IntValue:
+		return model.Int64(key, v.IntValue)
+	case *commonpb.AnyValue_DoubleValue:
+		return model.Float64(key, v.DoubleValue)
+	case *commonpb.AnyValue_BytesValue:
+		return model.Binary(key, v.BytesValue)
+	default:
+		serialized, err := json.Marshal(anyValue(value))
+		if err != nil {
+			return model.String(key, "")
+		}
+		return model.String(key, string(serialized))
+	}
+}
+
+// anyValue converts arrays and key-value lists to plain Go values so they can be serialized as JSON
+func anyValue(value *commonpb.AnyValue) interface{} {
+	switch v := value.GetValue().(type) {
+	case *commonpb.AnyValue_StringValue:
+		return v.StringValue
+	case *commonpb.AnyValue_BoolValue:
+		return v.BoolValue
+	case *commonpb.AnyValue_IntValue:
+		return v.IntValue
+	case *commonpb.AnyValue_DoubleValue:
+		return v.DoubleValue
+	case *commonpb.AnyValue_BytesValue:
+		return v.BytesValue
+	case *commonpb.AnyValue_ArrayValue:
+		values := make([]interface{}, 0, len(v.ArrayValue.GetValues()))
+		for _, item := range v.ArrayValue.GetValues() {
+			values = append(values, anyValue(item))
+		}
+		return values
+	case *commonpb.AnyValue_KvlistValue:
+		values := make(map[string]interface{}, len(v.KvlistValue.GetValues()))
+		for _, item := range v.KvlistValue.GetValues() {
+			values[item.GetKey()] = anyValue(item.GetValue())
+		}
+		return values
+	default:
+		return nil
+	}
+}
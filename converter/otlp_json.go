@@ -0,0 +1,82 @@
+package converter
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+
+	"github.com/jaegertracing/jaeger/model"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// idFields are encoded as hex strings in OTLP JSON rather than the base64 protojson expects
+var idFields = map[string]bool{
+	"traceId":        true,
+	"spanId":         true,
+	"parentSpanId":   true,
+	"trace_id":       true,
+	"span_id":        true,
+	"parent_span_id": true,
+}
+
+// UnmarshalOTLPJSON decodes an OTLP/JSON traces document. Timestamps may be given as numbers,
+// they are kept as json.Number so that their nanoseconds survive.
+func UnmarshalOTLPJSON(data []byte) (*tracepb.TracesData, error) {
+	var document interface{}
+	if err := unmarshalUseNumber(data, &document); err != nil {
+		return nil, err
+	}
+
+	if err := hexToBase64IDs(document); err != nil {
+		return nil, err
+	}
+
+	data, err := json.Marshal(document)
+	if err != nil {
+		return nil, err
+	}
+
+	traces := &tracepb.TracesData{}
+	if err := (protojson.UnmarshalOptions{DiscardUnknown: true}).Unmarshal(data, traces); err != nil {
+		return nil, err
+	}
+
+	return traces, nil
+}
+
+// FromOTLPJSON converts an OTLP/JSON traces document to Jaeger spans
+func FromOTLPJSON(data []byte) ([]*model.Span, error) {
+	traces, err := UnmarshalOTLPJSON(data)
+	if err != nil {
+		return nil, err
+	}
+
+	return FromOTLP(traces.GetResourceSpans())
+}
+
+func hexToBase64IDs(node interface{}) error {
+	switch v := node.(type) {
+	case map[string]interface{}:
+		for key, value := range v {
+			if id, ok := value.(string); ok && idFields[key] {
+				raw, err := hex.DecodeString(id)
+				if err != nil {
+					return err
+				}
+				v[key] = base64.StdEncoding.EncodeToString(raw)
+				continue
+			}
+			if err := hexToBase64IDs(value); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		for _, value := range v {
+			if err := hexToBase64IDs(value); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,205 @@
+// Package otlpreceiver accepts spans over OTLP/gRPC and OTLP/HTTP and hands them to a span writer
+package otlpreceiver
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"sync"
+
+	hclog "github.com/hashicorp/go-hclog"
+	"github.com/jaegertracing/jaeger/storage/spanstore"
+	collectortrace "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/chhetripradeep/jaeger-duckdb/converter"
+)
+
+const (
+	tracesPath           = "/v1/traces"
+	contentTypeProtobuf  = "application/x-protobuf"
+	contentTypeJSON      = "application/json"
+	maxRequestBodyLength = 32 << 20
+)
+
+// Receiver converts OTLP resource spans to Jaeger spans and writes them
+type Receiver struct {
+	collectortrace.UnimplementedTraceServiceServer
+
+	logger     hclog.Logger
+	writer     spanstore.Writer
+	grpcServer *grpc.Server
+	httpServer *http.Server
+	done       sync.WaitGroup
+}
+
+func NewReceiver(logger hclog.Logger, writer spanstore.Writer) *Receiver {
+	return &Receiver{
+		logger: logger,
+		writer: writer,
+	}
+}
+
+// StartGRPC serves the OTLP trace service on endpoint in the background
+func (r *Receiver) StartGRPC(endpoint string) error {
+	listener, err := net.Listen("tcp", endpoint)
+	if err != nil {
+		return fmt.Errorf("could not listen on %s: %w", endpoint, err)
+	}
+
+	r.grpcServer = grpc.NewServer()
+	collectortrace.RegisterTraceServiceServer(r.grpcServer, r)
+
+	r.done.Add(1)
+	go func() {
+		defer r.done.Done()
+		r.logger.Info("Starting OTLP/gRPC receiver", "endpoint", endpoint)
+		if err := r.grpcServer.Serve(listener); err != nil {
+			r.logger.Error("OTLP/gRPC receiver stopped", "error", err)
+		}
+	}()
+
+	return nil
+}
+
+// StartHTTP serves OTLP/HTTP on endpoint in the background
+func (r *Receiver) StartHTTP(endpoint string) error {
+	listener, err := net.Listen("tcp", endpoint)
+	if err != nil {
+		return fmt.Errorf("could not listen on %s: %w", endpoint, err)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(tracesPath, r)
+	r.httpServer = &http.Server{Handler: mux}
+
+	r.done.Add(1)
+	go func() {
+		defer r.done.Done()
+		r.logger.Info("Starting OTLP/HTTP receiver", "endpoint", endpoint)
+		if err := r.httpServer.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			r.logger.Error("OTLP/HTTP receiver stopped", "error", err)
+		}
+	}()
+
+	return nil
+}
+
+// Export implements the OTLP/gRPC trace service
+func (r *Receiver) Export(ctx context.Context, request *collectortrace.ExportTraceServiceRequest) (*collectortrace.ExportTraceServiceResponse, error) {
+	if err := r.write(ctx, request.GetResourceSpans()); err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return &collectortrace.ExportTraceServiceResponse{}, nil
+}
+
+// ServeHTTP implements OTLP/HTTP for protobuf and JSON encoded requests
+func (r *Receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := readBody(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	contentType, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type"))
+
+	var resourceSpans []*tracepb.ResourceSpans
+	switch contentType {
+	case contentTypeProtobuf:
+		request := &collectortrace.ExportTraceServiceRequest{}
+		if err := proto.Unmarshal(body, request); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		resourceSpans = request.GetResourceSpans()
+	case contentTypeJSON:
+		traces, err := converter.UnmarshalOTLPJSON(body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		resourceSpans = traces.GetResourceSpans()
+	default:
+		http.Error(w, fmt.Sprintf("unsupported content type %q", contentType), http.StatusUnsupportedMediaType)
+		return
+	}
+
+	if err := r.write(req.Context(), resourceSpans); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var response []byte
+	if contentType == contentTypeJSON {
+		response, err = protojson.Marshal(&collectortrace.ExportTraceServiceResponse{})
+	} else {
+		response, err = proto.Marshal(&collectortrace.ExportTraceServiceResponse{})
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	_, _ = w.Write(response)
+}
+
+func readBody(req *http.Request) ([]byte, error) {
+	body := io.Reader(http.MaxBytesReader(nil, req.Body, maxRequestBodyLength))
+
+	if req.Header.Get("Content-Encoding") == "gzip" {
+		reader, err := gzip.NewReader(body)
+		if err != nil {
+			return nil, err
+		}
+		defer reader.Close()
+		body = reader
+	}
+
+	return io.ReadAll(body)
+}
+
+func (r *Receiver) write(ctx context.Context, resourceSpans []*tracepb.ResourceSpans) error {
+	spans, err := converter.FromOTLP(resourceSpans)
+	if err != nil {
+		return err
+	}
+
+	for _, span := range spans {
+		if err := r.writer.WriteSpan(ctx, span); err != nil {
+			return err
+		}
+	}
+
+	r.logger.Debug("Received OTLP spans", "size", len(spans))
+
+	return nil
+}
+
+// Close stops the gRPC and HTTP servers
+func (r *Receiver) Close() error {
+	var err error
+	if r.grpcServer != nil {
+		r.grpcServer.GracefulStop()
+	}
+	if r.httpServer != nil {
+		err = r.httpServer.Shutdown(context.Background())
+	}
+	r.done.Wait()
+	return err
+}
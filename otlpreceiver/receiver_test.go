@@ -0,0 +1,100 @@
+package otlpreceiver
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	hclog "github.com/hashicorp/go-hclog"
+	"github.com/jaegertracing/jaeger/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	collectortrace "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+type recordingWriter struct {
+	spans []*model.Span
+}
+
+func (w *recordingWriter) WriteSpan(_ context.Context, span *model.Span) error {
+	w.spans = append(w.spans, span)
+	return nil
+}
+
+func testRequest() *collectortrace.ExportTraceServiceRequest {
+	return &collectortrace.ExportTraceServiceRequest{
+		ResourceSpans: []*tracepb.ResourceSpans{{
+			Resource: &resourcepb.Resource{Attributes: []*commonpb.KeyValue{{
+				Key:   "service.name",
+				Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: "frontend"}},
+			}}},
+			ScopeSpans: []*tracepb.ScopeSpans{{
+				Spans: []*tracepb.Span{{
+					TraceId:           []byte{0, 0, 0, 0, 0, 0, 0, 1, 0, 0, 0, 0, 0, 0, 0, 2},
+					SpanId:            []byte{0, 0, 0, 0, 0, 0, 0, 3},
+					Name:              "GET /",
+					StartTimeUnixNano: 1_000_000_000,
+					EndTimeUnixNano:   2_000_000_000,
+				}},
+			}},
+		}},
+	}
+}
+
+func TestReceiver_Export(t *testing.T) {
+	writer := &recordingWriter{}
+	receiver := NewReceiver(hclog.NewNullLogger(), writer)
+
+	_, err := receiver.Export(context.Background(), testRequest())
+	require.NoError(t, err)
+
+	require.Len(t, writer.spans, 1)
+	assert.Equal(t, model.NewTraceID(1, 2), writer.spans[0].TraceID)
+	assert.Equal(t, "frontend", writer.spans[0].Process.ServiceName)
+}
+
+func TestReceiver_ServeHTTP(t *testing.T) {
+	protobufBody, err := proto.Marshal(testRequest())
+	require.NoError(t, err)
+
+	jsonBody := []byte(`{"resourceSpans":[{"resource":{"attributes":[{"key":"service.name","value":{"stringValue":"frontend"}}]},
+		"scopeSpans":[{"spans":[{"traceId":"00000000000000010000000000000002","spanId":"0000000000000003","name":"GET /",
+		"startTimeUnixNano":"1000000000","endTimeUnixNano":"2000000000"}]}]}]}`)
+
+	tests := []struct {
+		name        string
+		method      string
+		contentType string
+		body        []byte
+		status      int
+		spans       int
+	}{
+		{name: "protobuf", method: http.MethodPost, contentType: contentTypeProtobuf, body: protobufBody, status: http.StatusOK, spans: 1},
+		{name: "json", method: http.MethodPost, contentType: contentTypeJSON, body: jsonBody, status: http.StatusOK, spans: 1},
+		{name: "invalid json", method: http.MethodPost, contentType: contentTypeJSON, body: []byte("{"), status: http.StatusBadRequest},
+		{name: "unsupported content type", method: http.MethodPost, contentType: "text/plain", body: jsonBody, status: http.StatusUnsupportedMediaType},
+		{name: "get", method: http.MethodGet, status: http.StatusMethodNotAllowed},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			writer := &recordingWriter{}
+			receiver := NewReceiver(hclog.NewNullLogger(), writer)
+
+			req := httptest.NewRequest(test.method, tracesPath, bytes.NewReader(test.body))
+			req.Header.Set("Content-Type", test.contentType)
+			rec := httptest.NewRecorder()
+
+			receiver.ServeHTTP(rec, req)
+
+			assert.Equal(t, test.status, rec.Code)
+			assert.Len(t, writer.spans, test.spans)
+		})
+	}
+}
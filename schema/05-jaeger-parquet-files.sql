@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS jaeger_parquet_files (
+    path String,
+    tableName String,
+    minTimestamp Timestamp,
+    maxTimestamp Timestamp,
+    rowCount UInt64,
+    exportedAt Timestamp,
+);
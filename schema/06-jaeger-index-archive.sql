@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS jaeger_index_archive (
+     timestamp Timestamp,
+     traceID String,
+     service String,
+     operation String,
+     durationUs UInt64,
+     tags String[],
+);
@@ -0,0 +1,10 @@
+CREATE OR REPLACE VIEW jaeger_operations_archive
+AS
+SELECT
+    CAST(timestamp AS DATE) AS date,
+    service,
+    operation,
+    count() as count,
+FROM
+jaeger_index_archive
+GROUP BY date, service, operation;
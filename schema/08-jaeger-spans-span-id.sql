@@ -0,0 +1 @@
+ALTER TABLE jaeger_spans ADD COLUMN IF NOT EXISTS spanID String;
@@ -0,0 +1 @@
+ALTER TABLE jaeger_spans_archive ADD COLUMN IF NOT EXISTS spanID String;
@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS jaeger_index_stats (
+    hour Timestamp,
+    service String,
+    operation String,
+    rowCount UInt64,
+);
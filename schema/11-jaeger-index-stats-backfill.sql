@@ -0,0 +1,10 @@
+INSERT INTO jaeger_index_stats
+SELECT
+    date_trunc('hour', timestamp) AS hour,
+    service,
+    operation,
+    count(*) AS rowCount,
+FROM
+jaeger_index
+WHERE NOT EXISTS (SELECT 1 FROM jaeger_index_stats)
+GROUP BY hour, service, operation;
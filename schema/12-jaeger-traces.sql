@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS jaeger_traces (
+    traceID String,
+    startTime Timestamp,
+    endTime Timestamp,
+    durationUs UInt64,
+    spanCount UInt64,
+    rootService String,
+    rootOperation String,
+    hasError Boolean,
+);
@@ -0,0 +1,14 @@
+INSERT INTO jaeger_traces (traceID, startTime, endTime, durationUs, spanCount, rootService, rootOperation, hasError)
+SELECT
+    traceID,
+    min(timestamp) AS startTime,
+    max(timestamp + to_microseconds(durationUs::BIGINT)) AS endTime,
+    date_diff('microseconds', min(timestamp), max(timestamp + to_microseconds(durationUs::BIGINT))) AS durationUs,
+    count(*) AS spanCount,
+    NULL AS rootService,
+    NULL AS rootOperation,
+    bool_or(list_contains(tags, 'error=true')) AS hasError,
+FROM
+jaeger_index
+WHERE NOT EXISTS (SELECT 1 FROM jaeger_traces)
+GROUP BY traceID;
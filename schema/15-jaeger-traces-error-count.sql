@@ -0,0 +1 @@
+ALTER TABLE jaeger_traces ADD COLUMN IF NOT EXISTS errorCount UInt64;
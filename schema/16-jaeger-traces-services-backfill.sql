@@ -0,0 +1,5 @@
+UPDATE jaeger_traces
+SET
+    services = (SELECT list(DISTINCT service) FROM jaeger_index WHERE jaeger_index.traceID = jaeger_traces.traceID),
+    errorCount = (SELECT count(*) FROM jaeger_index WHERE jaeger_index.traceID = jaeger_traces.traceID AND list_contains(tags, 'error=true')),
+WHERE services IS NULL;
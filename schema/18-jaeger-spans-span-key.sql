@@ -0,0 +1 @@
+CREATE UNIQUE INDEX IF NOT EXISTS jaeger_spans_span_key ON jaeger_spans (traceID, spanID);
@@ -0,0 +1 @@
+CREATE INDEX IF NOT EXISTS jaeger_spans_archive_trace_id ON jaeger_spans_archive (traceID);
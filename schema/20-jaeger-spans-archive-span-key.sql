@@ -0,0 +1 @@
+CREATE UNIQUE INDEX IF NOT EXISTS jaeger_spans_archive_span_key ON jaeger_spans_archive (traceID, spanID);
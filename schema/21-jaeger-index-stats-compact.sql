@@ -0,0 +1,14 @@
+UPDATE jaeger_index_stats
+SET rowCount = (
+    SELECT sum(rowCount)
+    FROM jaeger_index_stats AS duplicates
+    WHERE duplicates.hour = jaeger_index_stats.hour
+      AND duplicates.service = jaeger_index_stats.service
+      AND duplicates.operation = jaeger_index_stats.operation
+)
+WHERE rowid IN (
+    SELECT min(rowid)
+    FROM jaeger_index_stats
+    GROUP BY hour, service, operation
+    HAVING count(*) > 1
+);
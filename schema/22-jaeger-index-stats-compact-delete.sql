@@ -0,0 +1,6 @@
+DELETE FROM jaeger_index_stats
+WHERE rowid NOT IN (
+    SELECT min(rowid)
+    FROM jaeger_index_stats
+    GROUP BY hour, service, operation
+);
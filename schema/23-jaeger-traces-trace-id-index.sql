@@ -0,0 +1 @@
+CREATE INDEX IF NOT EXISTS jaeger_traces_trace_id ON jaeger_traces (traceID);
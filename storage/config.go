@@ -1,6 +1,18 @@
 package storage
 
-import "time"
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	hclog "github.com/hashicorp/go-hclog"
+
+	"github.com/chhetripradeep/jaeger-duckdb/storage/duckdbspanstore"
+)
 
 const (
 	defaultBatchSize         = 1_000
@@ -8,50 +20,388 @@ const (
 	defaultDataFile          = "./jaeger.db"
 	defaultEncoding          = "json"
 	defaultIndexTable        = "jaeger_index"
+	defaultIndexStatsTable   = "jaeger_index_stats"
 	defaultInitSQLScriptsDir = "./schema"
+	defaultLogFormat         = "json"
+	defaultLogLevel          = "info"
 	defaultOperationsTable   = "jaeger_operations"
+	defaultParquetExportAge  = time.Hour * 24 * 7
+	defaultParquetFilesTable = "jaeger_parquet_files"
+	defaultParquetSourceUnit = "us"
+	defaultReopenInterval    = time.Second * 30
+	defaultReadyQueueRatio   = 0.8
 	defaultSpansTable        = "jaeger_spans"
 	defaultSpansArchiveTable = "jaeger_spans_archive"
+	defaultTracesTable       = "jaeger_traces"
+	defaultTracingEndpoint   = "localhost:4317"
+	defaultTracingSampling   = 1.0
+)
+
+const (
+	// TracingExporterOTLP sends the spans of the plugin to an OTLP/gRPC endpoint
+	TracingExporterOTLP = "otlp"
+	// TracingExporterSelf writes the spans of the plugin to its own tables
+	TracingExporterSelf = "self"
 )
 
+const (
+	maxBatchWriteSize     = 1_000_000
+	maxBatchFlushInterval = time.Hour
+)
+
+// defaultParquetSourceColumns maps the fields of a span to the columns of a Parquet source
+var defaultParquetSourceColumns = map[string]string{
+	"trace_id":       "trace_id",
+	"span_id":        "span_id",
+	"parent_span_id": "parent_span_id",
+	"service":        "service_name",
+	"operation":      "name",
+	"start_time":     "start_time",
+	"duration":       "duration",
+	"tags":           "",
+}
+
+// parquetDurationUnits maps the units accepted for the duration column of a Parquet source to their length
+var parquetDurationUnits = map[string]time.Duration{
+	"ns": time.Nanosecond,
+	"us": time.Microsecond,
+	"ms": time.Millisecond,
+	"s":  time.Second,
+}
+
+// settingNamePattern matches the names of DuckDB settings, they are interpolated into SET statements
+var settingNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// parquetSourceColumnRequired tells which fields of a span need a column in a Parquet source
+var parquetSourceColumnRequired = map[string]bool{
+	"trace_id":       true,
+	"span_id":        true,
+	"parent_span_id": false,
+	"service":        true,
+	"operation":      true,
+	"start_time":     true,
+	"duration":       true,
+	"tags":           false,
+}
+
 type Configuration struct {
-	BatchWriteSize     int64         `yaml:"batch_write_size"`
-	BatchFlushInterval time.Duration `yaml:"batch_flush_interval"`
-	DataFile           string        `yaml:"datafile"`
-	Encoding           string        `yaml:"encoding"`
-	IndexTable         string        `yaml:"index_table"`
-	InitSQLScriptsDir  string        `yaml:"init_sql_scripts_dir"`
-	OperationsTable    string        `yaml:"operations_table"`
-	SpansTable         string        `yaml:"spans_table"`
-	SpansArchiveTable  string        `yaml:"spans_archive_table"`
-}
-
-func (cfg *Configuration) setDefaults() {
+	AdminHTTPEndpoint             string            `yaml:"admin_http_endpoint"`
+	AdminPprof                    bool              `yaml:"admin_pprof"`
+	ArchiveBatchFlushInterval     time.Duration     `yaml:"archive_batch_flush_interval"`
+	ArchiveBatchWriteSize         int64             `yaml:"archive_batch_write_size"`
+	ArchiveDataFile               string            `yaml:"archive_datafile"`
+	ArchiveIndexTable             string            `yaml:"archive_index_table"`
+	ArchiveOperationsTable        string            `yaml:"archive_operations_table"`
+	ArchiveRetention              time.Duration     `yaml:"archive_retention"`
+	ArchiveSyncWrites             bool              `yaml:"archive_sync_writes"`
+	BatchWriteSize                int64             `yaml:"batch_write_size"`
+	BatchFlushInterval            time.Duration     `yaml:"batch_flush_interval"`
+	DataFile                      string            `yaml:"datafile"`
+	DuckDBCheckpointThreshold     string            `yaml:"duckdb_checkpoint_threshold"`
+	DuckDBMemoryLimit             string            `yaml:"duckdb_memory_limit"`
+	DuckDBPreserveInsertionOrder  *bool             `yaml:"duckdb_preserve_insertion_order"`
+	DuckDBSettings                map[string]string `yaml:"duckdb_settings"`
+	DuckDBTempDirectory           string            `yaml:"duckdb_temp_directory"`
+	DuckDBThreads                 int               `yaml:"duckdb_threads"`
+	Encoding                      string            `yaml:"encoding"`
+	GRPCServerEndpoint            string            `yaml:"grpc_server_endpoint"`
+	GRPCServerTLSCert             string            `yaml:"grpc_server_tls_cert"`
+	GRPCServerTLSClientCA         string            `yaml:"grpc_server_tls_client_ca"`
+	GRPCServerTLSEnabled          bool              `yaml:"grpc_server_tls_enabled"`
+	GRPCServerTLSKey              string            `yaml:"grpc_server_tls_key"`
+	IndexStatsTable               string            `yaml:"index_stats_table"`
+	IndexTable                    string            `yaml:"index_table"`
+	InitSQLScriptsDir             string            `yaml:"init_sql_scripts_dir"`
+	LogFormat                     string            `yaml:"log_format"`
+	LogLevel                      string            `yaml:"log_level"`
+	OTLPGRPCEndpoint              string            `yaml:"otlp_grpc_endpoint"`
+	OTLPHTTPEndpoint              string            `yaml:"otlp_http_endpoint"`
+	OperationsTable               string            `yaml:"operations_table"`
+	ParquetDir                    string            `yaml:"parquet_dir"`
+	ParquetExportAge              time.Duration     `yaml:"parquet_export_age"`
+	ParquetExportInterval         time.Duration     `yaml:"parquet_export_interval"`
+	ParquetFilesTable             string            `yaml:"parquet_files_table"`
+	ParquetSourceColumns          map[string]string `yaml:"parquet_source_columns"`
+	ParquetSourceDurationUnit     string            `yaml:"parquet_source_duration_unit"`
+	ParquetSourceGlob             string            `yaml:"parquet_source_glob"`
+	ParquetSourceHivePartitioning bool              `yaml:"parquet_source_hive_partitioning"`
+	ParquetSourceSettings         map[string]string `yaml:"parquet_source_settings"`
+	ReadOnly                      bool              `yaml:"read_only"`
+	ReadOnlyReopenInterval        time.Duration     `yaml:"read_only_reopen_interval"`
+	ReadyMaxQueueLength           int               `yaml:"ready_max_queue_length"`
+	SearchTraceDuration           bool              `yaml:"search_trace_duration"`
+	SlowQueryThreshold            time.Duration     `yaml:"slow_query_threshold"`
+	SpansTable                    string            `yaml:"spans_table"`
+	SpansArchiveTable             string            `yaml:"spans_archive_table"`
+	SyncWrites                    bool              `yaml:"sync_writes"`
+	TracingExporter               string            `yaml:"tracing_exporter"`
+	TracingOTLPEndpoint           string            `yaml:"tracing_otlp_endpoint"`
+	TracingOTLPInsecure           bool              `yaml:"tracing_otlp_insecure"`
+	TracingSamplingRatio          float64           `yaml:"tracing_sampling_ratio"`
+	TracesTable                   string            `yaml:"traces_table"`
+}
+
+// SetDefaults fills the fields left empty with their default values
+func (cfg *Configuration) SetDefaults() {
 	if cfg.BatchWriteSize == 0 {
 		cfg.BatchWriteSize = defaultBatchSize
 	}
 	if cfg.BatchFlushInterval == 0 {
 		cfg.BatchFlushInterval = defaultBatchDelay
 	}
+	if cfg.ArchiveBatchWriteSize == 0 {
+		cfg.ArchiveBatchWriteSize = cfg.BatchWriteSize
+	}
+	if cfg.ArchiveBatchFlushInterval == 0 {
+		cfg.ArchiveBatchFlushInterval = cfg.BatchFlushInterval
+	}
 	if cfg.DataFile == "" {
 		cfg.DataFile = defaultDataFile
 	}
 	if cfg.Encoding == "" {
 		cfg.Encoding = defaultEncoding
 	}
+	if cfg.IndexStatsTable == "" {
+		cfg.IndexStatsTable = defaultIndexStatsTable
+	}
 	if cfg.IndexTable == "" {
 		cfg.IndexTable = defaultIndexTable
 	}
 	if cfg.InitSQLScriptsDir == "" {
 		cfg.InitSQLScriptsDir = defaultInitSQLScriptsDir
 	}
+	if cfg.LogFormat == "" {
+		cfg.LogFormat = defaultLogFormat
+	}
+	if cfg.LogLevel == "" {
+		cfg.LogLevel = defaultLogLevel
+	}
 	if cfg.OperationsTable == "" {
 		cfg.OperationsTable = defaultOperationsTable
 	}
+	if cfg.ParquetExportAge == 0 {
+		cfg.ParquetExportAge = defaultParquetExportAge
+	}
+	if cfg.ParquetFilesTable == "" {
+		cfg.ParquetFilesTable = defaultParquetFilesTable
+	}
+	if cfg.ParquetSourceColumns == nil {
+		cfg.ParquetSourceColumns = make(map[string]string, len(defaultParquetSourceColumns))
+	}
+	for field, column := range defaultParquetSourceColumns {
+		if _, ok := cfg.ParquetSourceColumns[field]; !ok {
+			cfg.ParquetSourceColumns[field] = column
+		}
+	}
+	if cfg.ParquetSourceDurationUnit == "" {
+		cfg.ParquetSourceDurationUnit = defaultParquetSourceUnit
+	}
+	if cfg.ReadOnlyReopenInterval == 0 {
+		cfg.ReadOnlyReopenInterval = defaultReopenInterval
+	}
+	if cfg.ReadyMaxQueueLength == 0 {
+		// WriteSpan blocks once a writer queue holds its batch size, readiness fails a bit earlier
+		capacity := cfg.BatchWriteSize
+		if cfg.ArchiveBatchWriteSize < capacity {
+			capacity = cfg.ArchiveBatchWriteSize
+		}
+		cfg.ReadyMaxQueueLength = int(float64(capacity) * defaultReadyQueueRatio)
+		if cfg.ReadyMaxQueueLength < 1 {
+			cfg.ReadyMaxQueueLength = 1
+		}
+	}
 	if cfg.SpansTable == "" {
 		cfg.SpansTable = defaultSpansTable
 	}
 	if cfg.SpansArchiveTable == "" {
 		cfg.SpansArchiveTable = defaultSpansArchiveTable
 	}
+	if cfg.TracingOTLPEndpoint == "" {
+		cfg.TracingOTLPEndpoint = defaultTracingEndpoint
+	}
+	if cfg.TracingSamplingRatio == 0 {
+		cfg.TracingSamplingRatio = defaultTracingSampling
+	}
+	if cfg.TracesTable == "" {
+		cfg.TracesTable = defaultTracesTable
+	}
+}
+
+// FieldError describes an invalid value of a configuration field
+type FieldError struct {
+	Field   string
+	Message string
+}
+
+func (e FieldError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Field, e.Message)
+}
+
+// ValidationError holds all the invalid fields of a configuration
+type ValidationError []FieldError
+
+func (e ValidationError) Error() string {
+	messages := make([]string, len(e))
+	for i, fieldError := range e {
+		messages[i] = fieldError.Error()
+	}
+	return "invalid configuration: " + strings.Join(messages, "; ")
+}
+
+// Validate checks a configuration with defaults applied and returns a ValidationError
+// listing every invalid field, or nil.
+func (cfg *Configuration) Validate() error {
+	var errs ValidationError
+	invalid := func(field, format string, args ...interface{}) {
+		errs = append(errs, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if cfg.ArchiveBatchFlushInterval <= 0 || cfg.ArchiveBatchFlushInterval > maxBatchFlushInterval {
+		invalid("archive_batch_flush_interval", "must be positive and at most %s, got %s", maxBatchFlushInterval, cfg.ArchiveBatchFlushInterval)
+	}
+	if cfg.ArchiveBatchWriteSize <= 0 || cfg.ArchiveBatchWriteSize > maxBatchWriteSize {
+		invalid("archive_batch_write_size", "must be between 1 and %d, got %d", maxBatchWriteSize, cfg.ArchiveBatchWriteSize)
+	}
+	if cfg.ArchiveDataFile != "" {
+		if dir := filepath.Dir(cfg.ArchiveDataFile); !isDir(dir) {
+			invalid("archive_datafile", "directory %s does not exist", dir)
+		}
+		if cfg.ArchiveDataFile == cfg.DataFile {
+			invalid("archive_datafile", "must differ from datafile")
+		}
+	}
+	if cfg.ArchiveOperationsTable != "" && cfg.ArchiveIndexTable == "" {
+		invalid("archive_operations_table", "requires archive_index_table to be set")
+	}
+	if cfg.ArchiveRetention < 0 {
+		invalid("archive_retention", "must not be negative, got %s", cfg.ArchiveRetention)
+	}
+	if cfg.ArchiveRetention > 0 && cfg.ReadOnly {
+		invalid("archive_retention", "cannot be used with read_only")
+	}
+	if cfg.BatchWriteSize <= 0 || cfg.BatchWriteSize > maxBatchWriteSize {
+		invalid("batch_write_size", "must be between 1 and %d, got %d", maxBatchWriteSize, cfg.BatchWriteSize)
+	}
+	if cfg.BatchFlushInterval <= 0 || cfg.BatchFlushInterval > maxBatchFlushInterval {
+		invalid("batch_flush_interval", "must be positive and at most %s, got %s", maxBatchFlushInterval, cfg.BatchFlushInterval)
+	}
+	if cfg.DataFile != ":memory:" {
+		if dir := filepath.Dir(cfg.DataFile); !isDir(dir) {
+			invalid("datafile", "directory %s does not exist", dir)
+		}
+	}
+	for _, name := range sortedKeys(cfg.DuckDBSettings) {
+		if !settingNamePattern.MatchString(name) {
+			invalid("duckdb_settings", "%q is not a valid setting name", name)
+		}
+	}
+	if cfg.DuckDBThreads < 0 {
+		invalid("duckdb_threads", "must not be negative, got %d", cfg.DuckDBThreads)
+	}
+	switch duckdbspanstore.Encoding(cfg.Encoding) {
+	case duckdbspanstore.EncodingJSON, duckdbspanstore.EncodingProto:
+	default:
+		invalid("encoding", "must be %q or %q, got %q", duckdbspanstore.EncodingJSON, duckdbspanstore.EncodingProto, cfg.Encoding)
+	}
+	if cfg.GRPCServerTLSEnabled {
+		if cfg.GRPCServerTLSCert == "" {
+			invalid("grpc_server_tls_cert", "is required when grpc_server_tls_enabled is set")
+		}
+		if cfg.GRPCServerTLSKey == "" {
+			invalid("grpc_server_tls_key", "is required when grpc_server_tls_enabled is set")
+		}
+	}
+	if cfg.ParquetSourceGlob == "" && !cfg.ReadOnly && !isDir(cfg.InitSQLScriptsDir) {
+		invalid("init_sql_scripts_dir", "directory %s does not exist", cfg.InitSQLScriptsDir)
+	}
+	switch cfg.LogFormat {
+	case "json", "text":
+	default:
+		invalid("log_format", "must be \"json\" or \"text\", got %q", cfg.LogFormat)
+	}
+	if hclog.LevelFromString(cfg.LogLevel) == hclog.NoLevel {
+		invalid("log_level", "must be one of trace, debug, info, warn or error, got %q", cfg.LogLevel)
+	}
+	if cfg.ParquetExportAge <= 0 {
+		invalid("parquet_export_age", "must be positive, got %s", cfg.ParquetExportAge)
+	}
+	if cfg.ParquetExportInterval < 0 {
+		invalid("parquet_export_interval", "must not be negative, got %s", cfg.ParquetExportInterval)
+	}
+	if cfg.ParquetExportInterval > 0 && cfg.ParquetDir == "" {
+		invalid("parquet_export_interval", "requires parquet_dir to be set")
+	}
+	for _, field := range sortedKeys(cfg.ParquetSourceColumns) {
+		column := cfg.ParquetSourceColumns[field]
+		required, known := parquetSourceColumnRequired[field]
+		if !known {
+			invalid("parquet_source_columns", "unknown field %q", field)
+		} else if required && column == "" {
+			invalid("parquet_source_columns", "field %q needs a column", field)
+		}
+	}
+	for _, name := range sortedKeys(cfg.ParquetSourceSettings) {
+		if !settingNamePattern.MatchString(name) {
+			invalid("parquet_source_settings", "%q is not a valid setting name", name)
+		}
+	}
+	if _, ok := parquetDurationUnits[cfg.ParquetSourceDurationUnit]; !ok {
+		invalid("parquet_source_duration_unit", "must be one of ns, us, ms or s, got %q", cfg.ParquetSourceDurationUnit)
+	}
+	if cfg.ReadOnly {
+		if cfg.ParquetExportInterval > 0 {
+			invalid("parquet_export_interval", "cannot be used with read_only")
+		}
+		if cfg.TracingExporter == TracingExporterSelf {
+			invalid("tracing_exporter", "%q cannot be used with read_only", TracingExporterSelf)
+		}
+	}
+	if cfg.ReadOnlyReopenInterval <= 0 {
+		invalid("read_only_reopen_interval", "must be positive, got %s", cfg.ReadOnlyReopenInterval)
+	}
+	if cfg.ReadyMaxQueueLength < 0 {
+		invalid("ready_max_queue_length", "must not be negative, got %d", cfg.ReadyMaxQueueLength)
+	}
+	if cfg.SlowQueryThreshold < 0 {
+		invalid("slow_query_threshold", "must not be negative, got %s", cfg.SlowQueryThreshold)
+	}
+	switch cfg.TracingExporter {
+	case "", "none", TracingExporterOTLP:
+	case TracingExporterSelf:
+		if cfg.ParquetSourceGlob != "" {
+			invalid("tracing_exporter", "%q cannot be used with parquet_source_glob", TracingExporterSelf)
+		}
+	default:
+		invalid("tracing_exporter", "must be %q, %q or \"none\", got %q", TracingExporterOTLP, TracingExporterSelf, cfg.TracingExporter)
+	}
+	if cfg.TracingSamplingRatio < 0 || cfg.TracingSamplingRatio > 1 {
+		invalid("tracing_sampling_ratio", "must be between 0 and 1, got %v", cfg.TracingSamplingRatio)
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// archiveDataFile returns the file holding the archive storage
+func (cfg *Configuration) archiveDataFile() string {
+	if cfg.ArchiveDataFile != "" {
+		return cfg.ArchiveDataFile
+	}
+	return cfg.DataFile
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func isDir(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
 }
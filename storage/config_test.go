@@ -0,0 +1,282 @@
+package storage
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfiguration_Validate(t *testing.T) {
+	dir := t.TempDir()
+
+	tests := []struct {
+		name   string
+		modify func(cfg *Configuration)
+		fields []string
+	}{
+		{
+			name:   "defaults",
+			modify: func(cfg *Configuration) {},
+		},
+		{
+			name:   "in-memory database",
+			modify: func(cfg *Configuration) { cfg.DataFile = ":memory:" },
+		},
+		{
+			name:   "archive data file",
+			modify: func(cfg *Configuration) { cfg.ArchiveDataFile = filepath.Join(dir, "archive.db") },
+		},
+		{
+			name:   "missing archive data directory",
+			modify: func(cfg *Configuration) { cfg.ArchiveDataFile = filepath.Join(dir, "missing", "archive.db") },
+			fields: []string{"archive_datafile"},
+		},
+		{
+			name:   "archive data file shared with the primary storage",
+			modify: func(cfg *Configuration) { cfg.ArchiveDataFile = cfg.DataFile },
+			fields: []string{"archive_datafile"},
+		},
+		{
+			name: "archive batch settings",
+			modify: func(cfg *Configuration) {
+				cfg.ArchiveBatchFlushInterval = 24 * time.Hour
+				cfg.ArchiveBatchWriteSize = -1
+			},
+			fields: []string{"archive_batch_flush_interval", "archive_batch_write_size"},
+		},
+		{
+			name:   "archive operations table without an archive index",
+			modify: func(cfg *Configuration) { cfg.ArchiveOperationsTable = "jaeger_operations_archive" },
+			fields: []string{"archive_operations_table"},
+		},
+		{
+			name:   "negative archive retention",
+			modify: func(cfg *Configuration) { cfg.ArchiveRetention = -time.Hour },
+			fields: []string{"archive_retention"},
+		},
+		{
+			name: "archive retention on a read-only replica",
+			modify: func(cfg *Configuration) {
+				cfg.ArchiveRetention = time.Hour
+				cfg.ReadOnly = true
+			},
+			fields: []string{"archive_retention"},
+		},
+		{
+			name:   "negative batch size",
+			modify: func(cfg *Configuration) { cfg.BatchWriteSize = -1 },
+			fields: []string{"batch_write_size"},
+		},
+		{
+			name:   "huge batch size",
+			modify: func(cfg *Configuration) { cfg.BatchWriteSize = maxBatchWriteSize + 1 },
+			fields: []string{"batch_write_size"},
+		},
+		{
+			name:   "negative flush interval",
+			modify: func(cfg *Configuration) { cfg.BatchFlushInterval = -time.Second },
+			fields: []string{"batch_flush_interval"},
+		},
+		{
+			name:   "absurd flush interval",
+			modify: func(cfg *Configuration) { cfg.BatchFlushInterval = 24 * time.Hour },
+			fields: []string{"batch_flush_interval"},
+		},
+		{
+			name:   "missing data directory",
+			modify: func(cfg *Configuration) { cfg.DataFile = filepath.Join(dir, "missing", "jaeger.db") },
+			fields: []string{"datafile"},
+		},
+		{
+			name: "invalid duckdb setting name",
+			modify: func(cfg *Configuration) {
+				cfg.DuckDBSettings = map[string]string{"threads=1; DROP TABLE jaeger_spans; --": "1"}
+			},
+			fields: []string{"duckdb_settings"},
+		},
+		{
+			name:   "negative duckdb threads",
+			modify: func(cfg *Configuration) { cfg.DuckDBThreads = -1 },
+			fields: []string{"duckdb_threads"},
+		},
+		{
+			name:   "unknown encoding",
+			modify: func(cfg *Configuration) { cfg.Encoding = "xml" },
+			fields: []string{"encoding"},
+		},
+		{
+			name:   "tls without certificate",
+			modify: func(cfg *Configuration) { cfg.GRPCServerTLSEnabled = true },
+			fields: []string{"grpc_server_tls_cert", "grpc_server_tls_key"},
+		},
+		{
+			name:   "missing init scripts directory",
+			modify: func(cfg *Configuration) { cfg.InitSQLScriptsDir = filepath.Join(dir, "missing") },
+			fields: []string{"init_sql_scripts_dir"},
+		},
+		{
+			name: "init scripts are not needed for a parquet source",
+			modify: func(cfg *Configuration) {
+				cfg.InitSQLScriptsDir = filepath.Join(dir, "missing")
+				cfg.ParquetSourceGlob = "/data/*.parquet"
+			},
+		},
+		{
+			name:   "unknown log format",
+			modify: func(cfg *Configuration) { cfg.LogFormat = "xml" },
+			fields: []string{"log_format"},
+		},
+		{
+			name:   "unknown log level",
+			modify: func(cfg *Configuration) { cfg.LogLevel = "loud" },
+			fields: []string{"log_level"},
+		},
+		{
+			name:   "negative parquet export age",
+			modify: func(cfg *Configuration) { cfg.ParquetExportAge = -time.Hour },
+			fields: []string{"parquet_export_age"},
+		},
+		{
+			name:   "negative parquet export interval",
+			modify: func(cfg *Configuration) { cfg.ParquetExportInterval = -time.Hour },
+			fields: []string{"parquet_export_interval"},
+		},
+		{
+			name:   "parquet export without directory",
+			modify: func(cfg *Configuration) { cfg.ParquetExportInterval = time.Hour },
+			fields: []string{"parquet_export_interval"},
+		},
+		{
+			name: "parquet source columns",
+			modify: func(cfg *Configuration) {
+				cfg.ParquetSourceColumns["trace_id"] = ""
+				cfg.ParquetSourceColumns["color"] = "color"
+			},
+			fields: []string{"parquet_source_columns", "parquet_source_columns"},
+		},
+		{
+			name:   "parquet source duration unit",
+			modify: func(cfg *Configuration) { cfg.ParquetSourceDurationUnit = "minutes" },
+			fields: []string{"parquet_source_duration_unit"},
+		},
+		{
+			name: "parquet source setting name",
+			modify: func(cfg *Configuration) {
+				cfg.ParquetSourceSettings = map[string]string{"s3_region='x'; DROP TABLE jaeger_spans; --": "1"}
+			},
+			fields: []string{"parquet_source_settings"},
+		},
+		{
+			name: "read-only replica",
+			modify: func(cfg *Configuration) {
+				cfg.ReadOnly = true
+				cfg.InitSQLScriptsDir = filepath.Join(dir, "missing")
+			},
+		},
+		{
+			name: "read-only replica cannot export or write its own spans",
+			modify: func(cfg *Configuration) {
+				cfg.ReadOnly = true
+				cfg.ParquetDir = dir
+				cfg.ParquetExportInterval = time.Hour
+				cfg.TracingExporter = TracingExporterSelf
+			},
+			fields: []string{"parquet_export_interval", "tracing_exporter"},
+		},
+		{
+			name:   "negative reopen interval",
+			modify: func(cfg *Configuration) { cfg.ReadOnlyReopenInterval = -time.Second },
+			fields: []string{"read_only_reopen_interval"},
+		},
+		{
+			name:   "negative ready queue length",
+			modify: func(cfg *Configuration) { cfg.ReadyMaxQueueLength = -1 },
+			fields: []string{"ready_max_queue_length"},
+		},
+		{
+			name:   "negative slow query threshold",
+			modify: func(cfg *Configuration) { cfg.SlowQueryThreshold = -time.Second },
+			fields: []string{"slow_query_threshold"},
+		},
+		{
+			name:   "unknown tracing exporter",
+			modify: func(cfg *Configuration) { cfg.TracingExporter = "zipkin" },
+			fields: []string{"tracing_exporter"},
+		},
+		{
+			name: "self tracing with a parquet source",
+			modify: func(cfg *Configuration) {
+				cfg.TracingExporter = TracingExporterSelf
+				cfg.ParquetSourceGlob = "/data/*.parquet"
+			},
+			fields: []string{"tracing_exporter"},
+		},
+		{
+			name:   "sampling ratio above one",
+			modify: func(cfg *Configuration) { cfg.TracingSamplingRatio = 2 },
+			fields: []string{"tracing_sampling_ratio"},
+		},
+		{
+			name: "aggregated errors",
+			modify: func(cfg *Configuration) {
+				cfg.BatchWriteSize = -1
+				cfg.Encoding = "xml"
+				cfg.LogLevel = "loud"
+			},
+			fields: []string{"batch_write_size", "encoding", "log_level"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg := Configuration{
+				DataFile:          filepath.Join(dir, "jaeger.db"),
+				InitSQLScriptsDir: dir,
+			}
+			cfg.SetDefaults()
+			test.modify(&cfg)
+
+			err := cfg.Validate()
+			if len(test.fields) == 0 {
+				assert.NoError(t, err)
+				return
+			}
+
+			var validationErr ValidationError
+			require.ErrorAs(t, err, &validationErr)
+
+			fields := make([]string, len(validationErr))
+			for i, fieldErr := range validationErr {
+				fields[i] = fieldErr.Field
+			}
+			assert.Equal(t, test.fields, fields)
+		})
+	}
+}
+
+func TestConfiguration_SetDefaults_readyMaxQueueLength(t *testing.T) {
+	for _, test := range []struct {
+		cfg      Configuration
+		expected int
+	}{
+		{cfg: Configuration{}, expected: 800},
+		{cfg: Configuration{BatchWriteSize: 100, ArchiveBatchWriteSize: 10}, expected: 8},
+		{cfg: Configuration{BatchWriteSize: 1}, expected: 1},
+		{cfg: Configuration{ReadyMaxQueueLength: 5000}, expected: 5000},
+	} {
+		test.cfg.SetDefaults()
+		assert.Equal(t, test.expected, test.cfg.ReadyMaxQueueLength)
+	}
+}
+
+func TestValidationError_Error(t *testing.T) {
+	err := ValidationError{
+		{Field: "encoding", Message: `must be "json" or "protobuf", got "xml"`},
+		{Field: "log_level", Message: "must be one of trace, debug, info, warn or error, got \"loud\""},
+	}
+
+	assert.EqualError(t, err, `invalid configuration: encoding: must be "json" or "protobuf", got "xml"; log_level: must be one of trace, debug, info, warn or error, got "loud"`)
+}
@@ -7,6 +7,7 @@ import (
 
 	"github.com/jaegertracing/jaeger/model"
 	"github.com/jaegertracing/jaeger/storage/dependencystore"
+	"github.com/uber/jaeger-lib/metrics"
 )
 
 var (
@@ -15,16 +16,30 @@ var (
 
 // DependencyStore handles all queries and insertions to DuckDB dependencies
 type DependencyStore struct {
+	metrics dependencyMetrics
+}
+
+type dependencyMetrics struct {
+	Attempts metrics.Counter `metric:"attempts" tags:"operation=get_dependencies"`
+	Errors   metrics.Counter `metric:"errors" tags:"operation=get_dependencies"`
+	Latency  metrics.Timer   `metric:"latency" tags:"operation=get_dependencies"`
 }
 
 var _ dependencystore.Reader = (*DependencyStore)(nil)
 
 // NewDependencyStore returns a DependencyStore
-func NewDependencyStore() *DependencyStore {
-	return &DependencyStore{}
+func NewDependencyStore(metricsFactory metrics.Factory) *DependencyStore {
+	store := &DependencyStore{}
+	metrics.MustInit(&store.metrics, metricsFactory.Namespace(metrics.NSOptions{Name: "dependency_reader"}), nil)
+	return store
 }
 
 // GetDependencies returns all inter-service dependencies, implements DependencyReader
 func (s *DependencyStore) GetDependencies(_ context.Context, _ time.Time, _ time.Duration) ([]model.DependencyLink, error) {
+	start := time.Now()
+	s.metrics.Attempts.Inc(1)
+	defer func() { s.metrics.Latency.Record(time.Since(start)) }()
+
+	s.metrics.Errors.Inc(1)
 	return nil, errNotImplemented
 }
@@ -6,10 +6,11 @@ import (
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/uber/jaeger-lib/metrics"
 )
 
 func TestDependencyStore_GetDependencies(t *testing.T) {
-	dependencyStore := NewDependencyStore()
+	dependencyStore := NewDependencyStore(metrics.NullFactory)
 	dependencies, err := dependencyStore.GetDependencies(context.Background(), time.Now(), time.Hour)
 
 	assert.EqualError(t, err, errNotImplemented.Error())
@@ -0,0 +1,179 @@
+package duckdbspanstore
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	hclog "github.com/hashicorp/go-hclog"
+)
+
+const parquetTimestampFormat = "2006-01-02 15:04:05.999999"
+
+var errNoParquetDir = errors.New("no parquet directory supplied")
+
+// ParquetFile describes a Parquet file holding rows exported from a live table
+type ParquetFile struct {
+	Path         string
+	Table        string
+	MinTimestamp time.Time
+	MaxTimestamp time.Time
+	RowCount     int64
+	ExportedAt   time.Time
+}
+
+// ParquetExporter moves rows of the span and index tables into Parquet files
+// and records every file it writes in a catalog table.
+type ParquetExporter struct {
+	logger     hclog.Logger
+	db         *sql.DB
+	indexTable string
+	spansTable string
+	filesTable string
+	dir        string
+}
+
+func NewParquetExporter(logger hclog.Logger, db *sql.DB, indexTable, spansTable, filesTable, dir string) *ParquetExporter {
+	return &ParquetExporter{
+		logger:     logger,
+		db:         db,
+		indexTable: indexTable,
+		spansTable: spansTable,
+		filesTable: filesTable,
+		dir:        dir,
+	}
+}
+
+// Export writes rows with a timestamp in [start, end) to Parquet files and
+// deletes them from the live tables.
+func (e *ParquetExporter) Export(ctx context.Context, start, end time.Time) ([]ParquetFile, error) {
+	if e.dir == "" {
+		return nil, errNoParquetDir
+	}
+
+	if !start.Before(end) {
+		return nil, nil
+	}
+
+	if err := os.MkdirAll(e.dir, 0o750); err != nil {
+		return nil, err
+	}
+
+	tables := []string{e.spansTable}
+	if e.indexTable != "" {
+		tables = append(tables, e.indexTable)
+	}
+
+	// Both tables are exported in one transaction, so the rows counted are the rows copied and
+	// deleted, and the spans never end up in a file without their index rows or the reverse
+	tx, err := e.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	files := make([]ParquetFile, 0, len(tables))
+	committed := false
+	defer func() {
+		if !committed {
+			_ = tx.Rollback()
+			for _, file := range files {
+				_ = os.Remove(file.Path)
+			}
+		}
+	}()
+
+	for _, table := range tables {
+		file, err := e.exportTable(ctx, tx, table, start, end)
+		if err != nil {
+			return nil, fmt.Errorf("could not export %s: %w", table, err)
+		}
+		if file != nil {
+			files = append(files, *file)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	committed = true
+
+	for _, file := range files {
+		e.logger.Info("Exported rows to parquet", "table", file.Table, "path", file.Path, "rows", file.RowCount)
+	}
+
+	return files, nil
+}
+
+// exportTable copies the rows of table in [start, end) to a Parquet file, records the file in the
+// catalog and deletes the rows, all within tx
+func (e *ParquetExporter) exportTable(ctx context.Context, tx *sql.Tx, table string, start, end time.Time) (*ParquetFile, error) {
+	rangeFilter := fmt.Sprintf(
+		"timestamp >= '%s' AND timestamp < '%s'",
+		start.UTC().Format(parquetTimestampFormat),
+		end.UTC().Format(parquetTimestampFormat),
+	)
+
+	file := ParquetFile{
+		Table:      table,
+		ExportedAt: time.Now().UTC(),
+	}
+
+	var minTimestamp, maxTimestamp sql.NullTime
+	err := tx.QueryRowContext(
+		ctx,
+		fmt.Sprintf("SELECT count(*), min(timestamp), max(timestamp) FROM %s WHERE %s", table, rangeFilter),
+	).Scan(&file.RowCount, &minTimestamp, &maxTimestamp)
+	if err != nil {
+		return nil, err
+	}
+
+	if file.RowCount == 0 {
+		return nil, nil
+	}
+
+	file.MinTimestamp = minTimestamp.Time.UTC()
+	file.MaxTimestamp = maxTimestamp.Time.UTC()
+	file.Path = filepath.Join(e.dir, fmt.Sprintf(
+		"%s-%s-%s.parquet",
+		table,
+		file.MinTimestamp.Format("20060102T150405.000000Z"),
+		file.MaxTimestamp.Format("20060102T150405.000000Z"),
+	))
+
+	if _, err := os.Stat(file.Path); err == nil {
+		return nil, fmt.Errorf("parquet file %s already exists", file.Path)
+	}
+
+	_, err = tx.ExecContext(
+		ctx,
+		fmt.Sprintf("COPY (SELECT * FROM %s WHERE %s) TO '%s' (FORMAT PARQUET)", table, rangeFilter, quoteString(file.Path)),
+	)
+	if err != nil {
+		_ = os.Remove(file.Path)
+		return nil, err
+	}
+
+	_, err = tx.ExecContext(
+		ctx,
+		fmt.Sprintf("INSERT INTO %s (path, tableName, minTimestamp, maxTimestamp, rowCount, exportedAt) VALUES (?, ?, ?, ?, ?, ?)", e.filesTable),
+		file.Path, file.Table, file.MinTimestamp, file.MaxTimestamp, file.RowCount, file.ExportedAt,
+	)
+	if err == nil {
+		_, err = tx.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE %s", table, rangeFilter))
+	}
+	if err != nil {
+		_ = os.Remove(file.Path)
+		return nil, err
+	}
+
+	return &file, nil
+}
+
+func quoteString(s string) string {
+	return strings.ReplaceAll(s, "'", "''")
+}
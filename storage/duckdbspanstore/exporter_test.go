@@ -0,0 +1,124 @@
+package duckdbspanstore
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	hclog "github.com/hashicorp/go-hclog"
+	"github.com/jaegertracing/jaeger/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/jaeger-lib/metrics"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// requireParquet skips the test when DuckDB was built without the Parquet extension
+func requireParquet(t *testing.T, db *sql.DB) {
+	path := filepath.Join(t.TempDir(), "probe.parquet")
+	if _, err := db.Exec("COPY (SELECT 1) TO '" + quoteString(path) + "' (FORMAT PARQUET)"); err != nil {
+		t.Skipf("DuckDB cannot write Parquet files: %v", err)
+	}
+}
+
+// newExportTestWriter returns a writer to a database with the live and catalog tables, holding a span
+// written every minute from start on. The first five spans are GET requests, the others POST requests.
+func newExportTestWriter(t *testing.T, start time.Time, spans int) *SpanWriter {
+	db := newTestDB(t,
+		"CREATE TABLE jaeger_index (timestamp Timestamp, traceID String, service String, operation String, durationUs UInt64, tags String[])",
+		"CREATE TABLE jaeger_spans (timestamp Timestamp, traceID String, spanID String, model String)",
+		"CREATE TABLE jaeger_parquet_files (path String, tableName String, minTimestamp Timestamp, maxTimestamp Timestamp, rowCount UInt64, exportedAt Timestamp)",
+	)
+	writer := NewSpanWriter(hclog.NewNullLogger(), db, "jaeger_index", "", "jaeger_spans", "", EncodingJSON, time.Hour, 10, true, metrics.NullFactory, trace.NewNoopTracerProvider())
+	t.Cleanup(func() { _ = writer.Close() })
+	requireParquet(t, db)
+
+	for i := 0; i < spans; i++ {
+		operation := "GET /"
+		if i >= 5 {
+			operation = "POST /"
+		}
+		require.NoError(t, writer.WriteSpan(context.Background(), &model.Span{
+			TraceID:       model.NewTraceID(0, uint64(i+1)),
+			SpanID:        model.NewSpanID(1),
+			OperationName: operation,
+			StartTime:     start.Add(time.Duration(i) * time.Minute),
+			Duration:      time.Millisecond,
+			Process:       model.NewProcess("frontend", []model.KeyValue{model.String("hostname", "host-1")}),
+		}))
+	}
+
+	return writer
+}
+
+func TestParquetExporter_Export(t *testing.T) {
+	start := time.Date(2022, 1, 1, 10, 0, 0, 0, time.UTC)
+	writer := newExportTestWriter(t, start, 10)
+	db := writer.db
+	dir := t.TempDir()
+
+	exporter := NewParquetExporter(hclog.NewNullLogger(), db, "jaeger_index", "jaeger_spans", "jaeger_parquet_files", dir)
+	files, err := exporter.Export(context.Background(), start, start.Add(6*time.Minute))
+	require.NoError(t, err)
+	require.Len(t, files, 2)
+
+	for i, table := range []string{"jaeger_spans", "jaeger_index"} {
+		file := files[i]
+		assert.Equal(t, table, file.Table)
+		assert.Equal(t, start, file.MinTimestamp)
+		assert.Equal(t, start.Add(5*time.Minute), file.MaxTimestamp)
+		assert.Equal(t, int64(6), file.RowCount)
+		assert.Equal(t, dir, filepath.Dir(file.Path))
+
+		_, err := os.Stat(file.Path)
+		require.NoError(t, err)
+
+		var exported, live int64
+		require.NoError(t, db.QueryRow("SELECT count(*) FROM read_parquet('"+quoteString(file.Path)+"')").Scan(&exported))
+		assert.Equal(t, int64(6), exported)
+		require.NoError(t, db.QueryRow("SELECT count(*) FROM "+table).Scan(&live))
+		assert.Equal(t, int64(4), live)
+
+		var (
+			path                       string
+			minTimestamp, maxTimestamp time.Time
+			rowCount                   int64
+		)
+		require.NoError(t, db.QueryRow(
+			"SELECT path, minTimestamp, maxTimestamp, rowCount FROM jaeger_parquet_files WHERE tableName = ?", table,
+		).Scan(&path, &minTimestamp, &maxTimestamp, &rowCount))
+		assert.Equal(t, file.Path, path)
+		assert.Equal(t, file.MinTimestamp, minTimestamp)
+		assert.Equal(t, file.MaxTimestamp, maxTimestamp)
+		assert.Equal(t, file.RowCount, rowCount)
+	}
+
+	files, err = exporter.Export(context.Background(), start, start.Add(6*time.Minute))
+	require.NoError(t, err)
+	assert.Empty(t, files)
+}
+
+func TestParquetExporter_Export_rollback(t *testing.T) {
+	start := time.Date(2022, 1, 1, 10, 0, 0, 0, time.UTC)
+	writer := newExportTestWriter(t, start, 10)
+	db := writer.db
+	dir := t.TempDir()
+
+	// The index export fails, the spans exported before it must be rolled back
+	exporter := NewParquetExporter(hclog.NewNullLogger(), db, "jaeger_missing_index", "jaeger_spans", "jaeger_parquet_files", dir)
+	_, err := exporter.Export(context.Background(), start, start.Add(time.Hour))
+	require.Error(t, err)
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+
+	var live, catalog int64
+	require.NoError(t, db.QueryRow("SELECT count(*) FROM jaeger_spans").Scan(&live))
+	assert.Equal(t, int64(10), live)
+	require.NoError(t, db.QueryRow("SELECT count(*) FROM jaeger_parquet_files").Scan(&catalog))
+	assert.Zero(t, catalog)
+}
@@ -0,0 +1,90 @@
+package duckdbspanstore
+
+import (
+	"context"
+	"time"
+
+	"github.com/jaegertracing/jaeger/model"
+	"github.com/jaegertracing/jaeger/storage/spanstore"
+	"github.com/uber/jaeger-lib/metrics"
+)
+
+// ReadMetricsDecorator wraps a spanstore.Reader and records the attempts, errors
+// and latency of every query made through it.
+type ReadMetricsDecorator struct {
+	reader        spanstore.Reader
+	getTrace      *queryMetrics
+	getServices   *queryMetrics
+	getOperations *queryMetrics
+	findTraces    *queryMetrics
+	findTraceIDs  *queryMetrics
+}
+
+var _ spanstore.Reader = (*ReadMetricsDecorator)(nil)
+
+type queryMetrics struct {
+	Attempts metrics.Counter `metric:"attempts"`
+	Errors   metrics.Counter `metric:"errors"`
+	Latency  metrics.Timer   `metric:"latency"`
+}
+
+func newQueryMetrics(factory metrics.Factory, operation string) *queryMetrics {
+	m := &queryMetrics{}
+	metrics.MustInit(m, factory, map[string]string{"operation": operation})
+	return m
+}
+
+func (m *queryMetrics) emit(start time.Time, err error) {
+	m.Attempts.Inc(1)
+	m.Latency.Record(time.Since(start))
+	if err != nil {
+		m.Errors.Inc(1)
+	}
+}
+
+func NewReadMetricsDecorator(reader spanstore.Reader, metricsFactory metrics.Factory) *ReadMetricsDecorator {
+	factory := metricsFactory.Namespace(metrics.NSOptions{Name: "reader"})
+	return &ReadMetricsDecorator{
+		reader:        reader,
+		getTrace:      newQueryMetrics(factory, "get_trace"),
+		getServices:   newQueryMetrics(factory, "get_services"),
+		getOperations: newQueryMetrics(factory, "get_operations"),
+		findTraces:    newQueryMetrics(factory, "find_traces"),
+		findTraceIDs:  newQueryMetrics(factory, "find_trace_ids"),
+	}
+}
+
+func (d *ReadMetricsDecorator) GetTrace(ctx context.Context, traceID model.TraceID) (*model.Trace, error) {
+	start := time.Now()
+	trace, err := d.reader.GetTrace(ctx, traceID)
+	d.getTrace.emit(start, err)
+	return trace, err
+}
+
+func (d *ReadMetricsDecorator) GetServices(ctx context.Context) ([]string, error) {
+	start := time.Now()
+	services, err := d.reader.GetServices(ctx)
+	d.getServices.emit(start, err)
+	return services, err
+}
+
+func (d *ReadMetricsDecorator) GetOperations(ctx context.Context, query spanstore.OperationQueryParameters) ([]spanstore.Operation, error) {
+	start := time.Now()
+	operations, err := d.reader.GetOperations(ctx, query)
+	d.getOperations.emit(start, err)
+	return operations, err
+}
+
+func (d *ReadMetricsDecorator) FindTraces(ctx context.Context, query *spanstore.TraceQueryParameters) ([]*model.Trace, error) {
+	start := time.Now()
+	traces, err := d.reader.FindTraces(ctx, query)
+	d.findTraces.emit(start, err)
+	return traces, err
+}
+
+func (d *ReadMetricsDecorator) FindTraceIDs(ctx context.Context, query *spanstore.TraceQueryParameters) ([]model.TraceID, error) {
+	start := time.Now()
+	traceIDs, err := d.reader.FindTraceIDs(ctx, query)
+	d.findTraceIDs.emit(start, err)
+	return traceIDs, err
+}
@@ -0,0 +1,56 @@
+package duckdbspanstore
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/jaegertracing/jaeger/model"
+	"github.com/jaegertracing/jaeger/storage/spanstore"
+	"github.com/stretchr/testify/assert"
+	"github.com/uber/jaeger-lib/metrics/metricstest"
+)
+
+var errTestQuery = errors.New("query failed")
+
+type stubReader struct{}
+
+func (stubReader) GetTrace(context.Context, model.TraceID) (*model.Trace, error) {
+	return nil, errTestQuery
+}
+
+func (stubReader) GetServices(context.Context) ([]string, error) {
+	return []string{"svc"}, nil
+}
+
+func (stubReader) GetOperations(context.Context, spanstore.OperationQueryParameters) ([]spanstore.Operation, error) {
+	return nil, nil
+}
+
+func (stubReader) FindTraces(context.Context, *spanstore.TraceQueryParameters) ([]*model.Trace, error) {
+	return nil, nil
+}
+
+func (stubReader) FindTraceIDs(context.Context, *spanstore.TraceQueryParameters) ([]model.TraceID, error) {
+	return nil, nil
+}
+
+func TestReadMetricsDecorator(t *testing.T) {
+	factory := metricstest.NewFactory(0)
+	defer factory.Stop()
+
+	reader := NewReadMetricsDecorator(stubReader{}, factory)
+
+	_, err := reader.GetTrace(context.Background(), model.NewTraceID(0, 1))
+	assert.Equal(t, errTestQuery, err)
+
+	services, err := reader.GetServices(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"svc"}, services)
+
+	counters, _ := factory.Snapshot()
+	assert.Equal(t, int64(1), counters["reader.attempts|operation=get_trace"])
+	assert.Equal(t, int64(1), counters["reader.errors|operation=get_trace"])
+	assert.Equal(t, int64(1), counters["reader.attempts|operation=get_services"])
+	assert.Equal(t, int64(0), counters["reader.errors|operation=get_services"])
+}
@@ -0,0 +1,351 @@
+package duckdbspanstore
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jaegertracing/jaeger/model"
+	"github.com/jaegertracing/jaeger/storage/spanstore"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ColumnMapping holds the SQL expressions that turn a row of a Parquet dataset into
+// the fields of a model.Span. TraceID, SpanID and ParentSpanID evaluate to hex strings,
+// StartTime to a TIMESTAMP, Duration to an integer counted in DurationUnit and Tags to
+// a list of "key=value" strings. ParentSpanID and Tags are optional. DurationUnit is a
+// microsecond when zero, OTLP exports count durations in nanoseconds.
+type ColumnMapping struct {
+	TraceID      string
+	SpanID       string
+	ParentSpanID string
+	Service      string
+	Operation    string
+	StartTime    string
+	Duration     string
+	Tags         string
+	DurationUnit time.Duration
+}
+
+// ParquetTraceReader serves spans straight from a Parquet dataset without ingesting it
+type ParquetTraceReader struct {
+	db               *sql.DB
+	glob             string
+	hivePartitioning bool
+	columns          ColumnMapping
+	tracer           trace.Tracer
+}
+
+var _ spanstore.Reader = (*ParquetTraceReader)(nil)
+
+func NewParquetTraceReader(db *sql.DB, glob string, hivePartitioning bool, columns ColumnMapping, tracerProvider trace.TracerProvider) *ParquetTraceReader {
+	return &ParquetTraceReader{
+		db:               db,
+		glob:             glob,
+		hivePartitioning: hivePartitioning,
+		columns:          columns,
+		tracer:           tracerProvider.Tracer(tracerName),
+	}
+}
+
+func (r *ParquetTraceReader) source() string {
+	hivePartitioning := 0
+	if r.hivePartitioning {
+		hivePartitioning = 1
+	}
+	return fmt.Sprintf("read_parquet('%s', hive_partitioning=%d)", quoteString(r.glob), hivePartitioning)
+}
+
+func (r *ParquetTraceReader) spanColumns() string {
+	parentSpanID := r.columns.ParentSpanID
+	if parentSpanID == "" {
+		parentSpanID = "NULL"
+	}
+
+	tags := r.columns.Tags
+	if tags == "" {
+		tags = "NULL"
+	}
+
+	return strings.Join([]string{
+		r.columns.TraceID,
+		r.columns.SpanID,
+		parentSpanID,
+		r.columns.Service,
+		r.columns.Operation,
+		r.columns.StartTime,
+		r.durationColumn(),
+		tags,
+	}, ", ")
+}
+
+// durationColumn converts the duration expression to microseconds
+func (r *ParquetTraceReader) durationColumn() string {
+	unit := r.columns.DurationUnit
+	switch {
+	case unit == 0 || unit == time.Microsecond:
+		return r.columns.Duration
+	case unit < time.Microsecond:
+		return fmt.Sprintf("CAST((%s) / %d AS BIGINT)", r.columns.Duration, time.Microsecond/unit)
+	default:
+		return fmt.Sprintf("CAST((%s) * %d AS BIGINT)", r.columns.Duration, unit/time.Microsecond)
+	}
+}
+
+// traceIDColumn normalizes the trace ID expression so that it compares equal to paddedTraceID
+func (r *ParquetTraceReader) traceIDColumn() string {
+	return fmt.Sprintf("lpad(lower(%s), 32, '0')", r.columns.TraceID)
+}
+
+func paddedTraceID(traceID model.TraceID) string {
+	return fmt.Sprintf("%016x%016x", traceID.High, traceID.Low)
+}
+
+func (r *ParquetTraceReader) getTraces(ctx context.Context, traceIDs []model.TraceID) ([]*model.Trace, error) {
+	result := make([]*model.Trace, 0, len(traceIDs))
+	if len(traceIDs) == 0 {
+		return result, nil
+	}
+
+	ctx, span := r.tracer.Start(ctx, "getTraces")
+	defer span.End()
+
+	values := make([]interface{}, len(traceIDs))
+	for i, traceID := range traceIDs {
+		values[i] = paddedTraceID(traceID)
+	}
+
+	query := fmt.Sprintf(
+		"SELECT %s FROM %s WHERE %s IN (%s)",
+		r.spanColumns(), r.source(), r.traceIDColumn(), "?"+strings.Repeat(",?", len(values)-1),
+	)
+
+	span.SetAttributes(dbSystem, attribute.String("db.statement", query))
+	span.SetAttributes(attribute.String("db.args", fmt.Sprint(values)))
+
+	rows, err := r.db.QueryContext(ctx, query, values...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	traces := map[model.TraceID]*model.Trace{}
+	seen := map[spanKey]struct{}{}
+
+	for rows.Next() {
+		span, err := scanParquetSpan(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		addSpan(traces, seen, span)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, traceID := range traceIDs {
+		if trace, ok := traces[traceID]; ok {
+			result = append(result, trace)
+		}
+	}
+
+	return result, nil
+}
+
+func scanParquetSpan(rows *sql.Rows) (*model.Span, error) {
+	var (
+		traceIDString      string
+		spanIDString       string
+		parentSpanIDString sql.NullString
+		service            string
+		operation          string
+		startTime          time.Time
+		durationUs         int64
+		tags               interface{}
+	)
+
+	err := rows.Scan(&traceIDString, &spanIDString, &parentSpanIDString, &service, &operation, &startTime, &durationUs, &tags)
+	if err != nil {
+		return nil, err
+	}
+
+	traceID, err := model.TraceIDFromString(traceIDString)
+	if err != nil {
+		return nil, err
+	}
+
+	spanID, err := model.SpanIDFromString(spanIDString)
+	if err != nil {
+		return nil, err
+	}
+
+	span := &model.Span{
+		TraceID:       traceID,
+		SpanID:        spanID,
+		OperationName: operation,
+		StartTime:     startTime.UTC(),
+		Duration:      time.Duration(durationUs) * time.Microsecond,
+		Process:       &model.Process{ServiceName: service},
+	}
+
+	if parentSpanIDString.Valid && strings.Trim(parentSpanIDString.String, "0") != "" {
+		parentSpanID, err := model.SpanIDFromString(parentSpanIDString.String)
+		if err != nil {
+			return nil, err
+		}
+		span.References = []model.SpanRef{model.NewChildOfRef(traceID, parentSpanID)}
+	}
+
+	if list, ok := tags.([]interface{}); ok {
+		for _, tag := range list {
+			kv, ok := tag.(string)
+			if !ok {
+				continue
+			}
+			if key, value, found := strings.Cut(kv, "="); found {
+				span.Tags = append(span.Tags, model.String(key, value))
+			}
+		}
+	}
+
+	return span, nil
+}
+
+func (r *ParquetTraceReader) GetTrace(ctx context.Context, traceID model.TraceID) (*model.Trace, error) {
+	ctx, span := r.tracer.Start(ctx, "GetTrace")
+	defer span.End()
+
+	traces, err := r.getTraces(ctx, []model.TraceID{traceID})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(traces) == 0 {
+		return nil, spanstore.ErrTraceNotFound
+	}
+
+	return traces[0], nil
+}
+
+func (r *ParquetTraceReader) GetServices(ctx context.Context) ([]string, error) {
+	ctx, span := r.tracer.Start(ctx, "GetServices")
+	defer span.End()
+
+	query := fmt.Sprintf("SELECT DISTINCT %s FROM %s", r.columns.Service, r.source())
+
+	span.SetAttributes(dbSystem, attribute.String("db.statement", query))
+
+	return getStrings(ctx, r.db, query)
+}
+
+func (r *ParquetTraceReader) GetOperations(
+	ctx context.Context,
+	params spanstore.OperationQueryParameters,
+) ([]spanstore.Operation, error) {
+	ctx, span := r.tracer.Start(ctx, "GetOperations")
+	defer span.End()
+
+	query := fmt.Sprintf(
+		"SELECT DISTINCT %s FROM %s WHERE %s = ?",
+		r.columns.Operation, r.source(), r.columns.Service,
+	)
+	args := []interface{}{params.ServiceName}
+
+	span.SetAttributes(dbSystem, attribute.String("db.statement", query))
+	span.SetAttributes(attribute.String("db.args", fmt.Sprint(args)))
+
+	names, err := getStrings(ctx, r.db, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	operations := make([]spanstore.Operation, len(names))
+	for i, name := range names {
+		operations[i].Name = name
+	}
+
+	return operations, nil
+}
+
+func (r *ParquetTraceReader) FindTraces(ctx context.Context, query *spanstore.TraceQueryParameters) ([]*model.Trace, error) {
+	ctx, span := r.tracer.Start(ctx, "FindTraces")
+	defer span.End()
+
+	traceIDs, err := r.FindTraceIDs(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.getTraces(ctx, traceIDs)
+}
+
+func (r *ParquetTraceReader) FindTraceIDs(ctx context.Context, params *spanstore.TraceQueryParameters) ([]model.TraceID, error) {
+	ctx, span := r.tracer.Start(ctx, "FindTraceIDs")
+	defer span.End()
+
+	if params.StartTimeMin.IsZero() {
+		return nil, errStartTimeRequired
+	}
+
+	end := params.StartTimeMax
+	if end.IsZero() {
+		end = time.Now()
+	}
+
+	query := fmt.Sprintf(
+		"SELECT %s AS traceID FROM %s WHERE %s = ? AND %s >= ? AND %s <= ?",
+		r.traceIDColumn(), r.source(), r.columns.Service, r.columns.StartTime, r.columns.StartTime,
+	)
+	args := []interface{}{params.ServiceName, params.StartTimeMin, end}
+
+	if params.OperationName != "" {
+		query += fmt.Sprintf(" AND %s = ?", r.columns.Operation)
+		args = append(args, params.OperationName)
+	}
+
+	if params.DurationMin != 0 {
+		query += fmt.Sprintf(" AND %s >= ?", r.durationColumn())
+		args = append(args, params.DurationMin.Microseconds())
+	}
+
+	if params.DurationMax != 0 {
+		query += fmt.Sprintf(" AND %s <= ?", r.durationColumn())
+		args = append(args, params.DurationMax.Microseconds())
+	}
+
+	if len(params.Tags) > 0 && r.columns.Tags == "" {
+		return []model.TraceID{}, nil
+	}
+
+	for key, value := range params.Tags {
+		query += fmt.Sprintf(" AND list_contains(%s, ?)", r.columns.Tags)
+		args = append(args, fmt.Sprintf("%s=%s", key, value))
+	}
+
+	query += fmt.Sprintf(" GROUP BY traceID ORDER BY min(%s) DESC LIMIT ?", r.columns.StartTime)
+	args = append(args, numTraces(params))
+
+	span.SetAttributes(dbSystem, attribute.String("db.statement", query))
+	span.SetAttributes(attribute.String("db.args", fmt.Sprint(args)))
+
+	traceIDStrings, err := getStrings(ctx, r.db, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	traceIDs := make([]model.TraceID, len(traceIDStrings))
+	for i, traceIDString := range traceIDStrings {
+		traceID, err := model.TraceIDFromString(traceIDString)
+		if err != nil {
+			return nil, err
+		}
+		traceIDs[i] = traceID
+	}
+
+	return traceIDs, nil
+}
@@ -0,0 +1,131 @@
+package duckdbspanstore
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jaegertracing/jaeger/model"
+	"github.com/jaegertracing/jaeger/storage/spanstore"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestParquetTraceReader_source(t *testing.T) {
+	reader := NewParquetTraceReader(nil, "/data/otlp/**/*.parquet", true, ColumnMapping{}, trace.NewNoopTracerProvider())
+	assert.Equal(t, "read_parquet('/data/otlp/**/*.parquet', hive_partitioning=1)", reader.source())
+
+	reader = NewParquetTraceReader(nil, "/data/it's/*.parquet", false, ColumnMapping{}, trace.NewNoopTracerProvider())
+	assert.Equal(t, "read_parquet('/data/it''s/*.parquet', hive_partitioning=0)", reader.source())
+}
+
+func TestParquetTraceReader_durationColumn(t *testing.T) {
+	for unit, expected := range map[time.Duration]string{
+		0:                "duration",
+		time.Microsecond: "duration",
+		time.Nanosecond:  "CAST((duration) / 1000 AS BIGINT)",
+		time.Millisecond: "CAST((duration) * 1000 AS BIGINT)",
+	} {
+		reader := NewParquetTraceReader(nil, "", false, ColumnMapping{Duration: "duration", DurationUnit: unit}, trace.NewNoopTracerProvider())
+		assert.Equal(t, expected, reader.durationColumn(), unit)
+	}
+}
+
+func TestParquetTraceReader_file(t *testing.T) {
+	db := newTestDB(t)
+	requireParquet(t, db)
+
+	// Two spans of one trace and a span of another, with OTLP-style nanosecond durations
+	path := filepath.Join(t.TempDir(), "spans.parquet")
+	_, err := db.Exec(`COPY (
+		SELECT '00000000000000000000000000000001' AS trace_id, '0000000000000001' AS span_id, NULL AS parent_span_id,
+			'frontend' AS service_name, 'GET /' AS name, TIMESTAMP '2022-01-01 10:00:00' AS start_time, 3000000000 AS duration
+		UNION ALL SELECT '00000000000000000000000000000001', '0000000000000002', '0000000000000001',
+			'backend', 'SELECT', TIMESTAMP '2022-01-01 10:00:01', 1500000
+		UNION ALL SELECT '00000000000000000000000000000002', '0000000000000003', NULL,
+			'frontend', 'GET /', TIMESTAMP '2022-01-01 11:00:00', 2000000
+	) TO '` + quoteString(path) + `' (FORMAT PARQUET)`)
+	require.NoError(t, err)
+
+	reader := NewParquetTraceReader(db, path, false, ColumnMapping{
+		TraceID:      "trace_id",
+		SpanID:       "span_id",
+		ParentSpanID: "parent_span_id",
+		Service:      "service_name",
+		Operation:    "name",
+		StartTime:    "start_time",
+		Duration:     "duration",
+		DurationUnit: time.Nanosecond,
+	}, trace.NewNoopTracerProvider())
+	ctx := context.Background()
+
+	services, err := reader.GetServices(ctx)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"frontend", "backend"}, services)
+
+	start := time.Date(2022, 1, 1, 9, 0, 0, 0, time.UTC)
+	traceIDs, err := reader.FindTraceIDs(ctx, &spanstore.TraceQueryParameters{
+		ServiceName:  "frontend",
+		StartTimeMin: start,
+		StartTimeMax: start.Add(3 * time.Hour),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []model.TraceID{model.NewTraceID(0, 2), model.NewTraceID(0, 1)}, traceIDs)
+
+	traceIDs, err = reader.FindTraceIDs(ctx, &spanstore.TraceQueryParameters{
+		ServiceName:  "frontend",
+		StartTimeMin: start,
+		StartTimeMax: start.Add(3 * time.Hour),
+		DurationMin:  2500 * time.Millisecond,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []model.TraceID{model.NewTraceID(0, 1)}, traceIDs)
+
+	trace, err := reader.GetTrace(ctx, model.NewTraceID(0, 1))
+	require.NoError(t, err)
+	require.Len(t, trace.Spans, 2)
+	durations := map[model.SpanID]time.Duration{}
+	for _, span := range trace.Spans {
+		durations[span.SpanID] = span.Duration
+	}
+	assert.Equal(t, map[model.SpanID]time.Duration{
+		model.NewSpanID(1): 3 * time.Second,
+		model.NewSpanID(2): 1500 * time.Microsecond,
+	}, durations)
+}
+
+func TestScanParquetSpan(t *testing.T) {
+	db := newTestDB(t)
+
+	rows, err := db.Query(`SELECT
+		'00000000000000010000000000000002', '0000000000000003', '0000000000000004',
+		'svc', 'op', TIMESTAMP '2022-01-01 10:00:00.123456', 1500, ['http.method=GET', 'invalid']
+	UNION ALL SELECT
+		'1', '5', NULL, 'svc', 'root', TIMESTAMP '2022-01-01 10:00:00', 10, NULL`)
+	require.NoError(t, err)
+	defer rows.Close()
+
+	var spans []*model.Span
+	for rows.Next() {
+		span, err := scanParquetSpan(rows)
+		require.NoError(t, err)
+		spans = append(spans, span)
+	}
+	require.NoError(t, rows.Err())
+	require.Len(t, spans, 2)
+
+	assert.Equal(t, model.NewTraceID(1, 2), spans[0].TraceID)
+	assert.Equal(t, model.NewSpanID(3), spans[0].SpanID)
+	assert.Equal(t, model.NewSpanID(4), spans[0].ParentSpanID())
+	assert.Equal(t, "svc", spans[0].Process.ServiceName)
+	assert.Equal(t, "op", spans[0].OperationName)
+	assert.Equal(t, time.Date(2022, 1, 1, 10, 0, 0, 123456000, time.UTC), spans[0].StartTime)
+	assert.Equal(t, 1500*time.Microsecond, spans[0].Duration)
+	assert.Equal(t, []model.KeyValue{model.String("http.method", "GET")}, spans[0].Tags)
+
+	assert.Equal(t, model.NewTraceID(0, 1), spans[1].TraceID)
+	assert.Empty(t, spans[1].References)
+	assert.Empty(t, spans[1].Tags)
+}
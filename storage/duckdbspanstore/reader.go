@@ -12,37 +12,117 @@ import (
 	"github.com/gogo/protobuf/proto"
 	"github.com/jaegertracing/jaeger/model"
 	"github.com/jaegertracing/jaeger/storage/spanstore"
-	opentracing "github.com/opentracing/opentracing-go"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 const (
+	// defaultNumTraces is the number of traces a search returns when the query does not set it
+	defaultNumTraces = 100
+
 	minTimespanForProgressiveSearch       = time.Hour
 	minTimespanForProgressiveSearchMargin = time.Minute
-	maxProgressiveSteps                   = 4
+
+	// initialRowsPerTrace is the number of index rows the first search window holds per trace wanted
+	initialRowsPerTrace = 10
+	// rowsPerTraceGrowth multiplies the rows per trace after a window without any trace found
+	rowsPerTraceGrowth = 4
 )
 
 var (
 	errNoOperationsTable = errors.New("no operations table supplied")
 	errNoIndexTable      = errors.New("no index table supplied")
+	errNoTracesTable     = errors.New("no traces table supplied")
 	errStartTimeRequired = errors.New("start time is required for search queries")
 )
 
+const (
+	indexColumns = "timestamp, traceID, service, operation, durationUs, tags"
+	spansColumns = "timestamp, traceID, model"
+)
+
 type TraceReader struct {
 	db              *sql.DB
 	indexTable      string
+	statsTable      string
 	operationsTable string
 	spansTable      string
+	tracesTable     string
+	filesTable      string
+	traceDurations  bool
+	tracer          trace.Tracer
 }
 
 var _ spanstore.Reader = (*TraceReader)(nil)
 
-func NewTraceReader(db *sql.DB, indexTable, operationsTable, spansTable string) *TraceReader {
+// NewTraceReader returns a TraceReader. When filesTable is not empty, Parquet files
+// exported from the index and spans tables are queried along with the live tables.
+// Searches size their time windows from statsTable, or from the index when it is empty.
+// Trace summaries are read from tracesTable, where duration filters are applied when traceDurations
+// is set to match whole traces instead of single spans.
+func NewTraceReader(db *sql.DB, indexTable, statsTable, operationsTable, spansTable, tracesTable, filesTable string, traceDurations bool, tracerProvider trace.TracerProvider) *TraceReader {
 	return &TraceReader{
 		db:              db,
 		indexTable:      indexTable,
+		statsTable:      statsTable,
 		operationsTable: operationsTable,
 		spansTable:      spansTable,
+		tracesTable:     tracesTable,
+		filesTable:      filesTable,
+		traceDurations:  traceDurations && tracesTable != "",
+		tracer:          tracerProvider.Tracer(tracerName),
+	}
+}
+
+// parquetFiles returns the Parquet files exported from table whose time bounds overlap
+// [start, end]. A zero start or end leaves that side of the range unbounded.
+func (r *TraceReader) parquetFiles(ctx context.Context, table string, start, end time.Time) ([]string, error) {
+	if r.filesTable == "" {
+		return nil, nil
+	}
+
+	query := fmt.Sprintf("SELECT path FROM %s WHERE tableName = ?", r.filesTable)
+	args := []interface{}{table}
+
+	if !start.IsZero() {
+		query += " AND maxTimestamp >= ?"
+		args = append(args, start)
+	}
+
+	if !end.IsZero() {
+		query += " AND minTimestamp <= ?"
+		args = append(args, end)
+	}
+
+	query += " ORDER BY minTimestamp"
+
+	return r.getStrings(ctx, query, args...)
+}
+
+// tableSource returns what to select from to see both the live rows of table and
+// the rows exported from it to Parquet files within [start, end].
+func (r *TraceReader) tableSource(ctx context.Context, table, columns string, start, end time.Time) (string, error) {
+	files, err := r.parquetFiles(ctx, table, start, end)
+	if err != nil {
+		return "", err
+	}
+
+	if len(files) == 0 {
+		return table, nil
+	}
+
+	return fmt.Sprintf(
+		"(SELECT %s FROM %s UNION ALL SELECT %s FROM read_parquet(%s)) AS %s",
+		columns, table, columns, parquetFileList(files), table,
+	), nil
+}
+
+func parquetFileList(files []string) string {
+	quoted := make([]string, len(files))
+	for i, file := range files {
+		quoted[i] = "'" + quoteString(file) + "'"
 	}
+	return "[" + strings.Join(quoted, ", ") + "]"
 }
 
 func (r *TraceReader) getTraces(ctx context.Context, traceIDS []model.TraceID) ([]*model.Trace, error) {
@@ -51,18 +131,23 @@ func (r *TraceReader) getTraces(ctx context.Context, traceIDS []model.TraceID) (
 		return result, nil
 	}
 
-	span, _ := opentracing.StartSpanFromContext(ctx, "getTraces")
-	defer span.Finish()
+	ctx, span := r.tracer.Start(ctx, "getTraces")
+	defer span.End()
 
 	values := make([]interface{}, len(traceIDS))
 	for i, traceId := range traceIDS {
 		values[i] = traceId.String()
 	}
 
-	query := fmt.Sprintf("SELECT model FROM %s WHERE traceID IN (%s)", r.spansTable, "?"+strings.Repeat(",?", len(values)-1))
+	source, err := r.tableSource(ctx, r.spansTable, spansColumns, time.Time{}, time.Time{})
+	if err != nil {
+		return nil, err
+	}
+
+	query := fmt.Sprintf("SELECT model FROM %s WHERE traceID IN (%s)", source, "?"+strings.Repeat(",?", len(values)-1))
 
-	span.SetTag("db.statement", query)
-	span.SetTag("db.args", values)
+	span.SetAttributes(dbSystem, attribute.String("db.statement", query))
+	span.SetAttributes(attribute.String("db.args", fmt.Sprint(values)))
 
 	rows, err := r.db.QueryContext(ctx, query, values...)
 	if err != nil {
@@ -71,6 +156,7 @@ func (r *TraceReader) getTraces(ctx context.Context, traceIDS []model.TraceID) (
 	defer rows.Close()
 
 	traces := map[model.TraceID]*model.Trace{}
+	seen := map[spanKey]struct{}{}
 
 	for rows.Next() {
 		var serialized string
@@ -92,11 +178,7 @@ func (r *TraceReader) getTraces(ctx context.Context, traceIDS []model.TraceID) (
 			return nil, err
 		}
 
-		if _, ok := traces[span.TraceID]; !ok {
-			traces[span.TraceID] = &model.Trace{}
-		}
-
-		traces[span.TraceID].Spans = append(traces[span.TraceID].Spans, &span)
+		addSpan(traces, seen, &span)
 	}
 
 	if err := rows.Err(); err != nil {
@@ -113,8 +195,8 @@ func (r *TraceReader) getTraces(ctx context.Context, traceIDS []model.TraceID) (
 }
 
 func (r *TraceReader) GetTrace(ctx context.Context, traceID model.TraceID) (*model.Trace, error) {
-	span, ctx := opentracing.StartSpanFromContext(ctx, "GetTrace")
-	defer span.Finish()
+	ctx, span := r.tracer.Start(ctx, "GetTrace")
+	defer span.End()
 
 	traces, err := r.getTraces(ctx, []model.TraceID{traceID})
 	if err != nil {
@@ -128,8 +210,34 @@ func (r *TraceReader) GetTrace(ctx context.Context, traceID model.TraceID) (*mod
 	return traces[0], nil
 }
 
+// spanKey identifies a span across writes, a span written twice has the same key
+type spanKey struct {
+	traceID model.TraceID
+	spanID  model.SpanID
+}
+
+// addSpan adds span to its trace unless a span with the same ID was already added to it.
+// Rows written before spans were deduplicated on write may be stored more than once.
+func addSpan(traces map[model.TraceID]*model.Trace, seen map[spanKey]struct{}, span *model.Span) {
+	key := spanKey{traceID: span.TraceID, spanID: span.SpanID}
+	if _, ok := seen[key]; ok {
+		return
+	}
+	seen[key] = struct{}{}
+
+	if _, ok := traces[span.TraceID]; !ok {
+		traces[span.TraceID] = &model.Trace{}
+	}
+
+	traces[span.TraceID].Spans = append(traces[span.TraceID].Spans, span)
+}
+
 func (r *TraceReader) getStrings(ctx context.Context, sql string, args ...interface{}) ([]string, error) {
-	rows, err := r.db.QueryContext(ctx, sql, args...)
+	return getStrings(ctx, r.db, sql, args...)
+}
+
+func getStrings(ctx context.Context, db *sql.DB, query string, args ...interface{}) ([]string, error) {
+	rows, err := db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -154,16 +262,27 @@ func (r *TraceReader) getStrings(ctx context.Context, sql string, args ...interf
 }
 
 func (r *TraceReader) GetServices(ctx context.Context) ([]string, error) {
-	span, ctx := opentracing.StartSpanFromContext(ctx, "GetServices")
-	defer span.Finish()
+	ctx, span := r.tracer.Start(ctx, "GetServices")
+	defer span.End()
 
 	if r.operationsTable == "" {
 		return nil, errNoOperationsTable
 	}
 
+	files, err := r.parquetFiles(ctx, r.indexTable, time.Time{}, time.Time{})
+	if err != nil {
+		return nil, err
+	}
+
 	query := fmt.Sprintf("SELECT service FROM %s GROUP BY service", r.operationsTable)
+	if len(files) > 0 {
+		query = fmt.Sprintf(
+			"SELECT service FROM %s UNION SELECT service FROM read_parquet(%s)",
+			r.operationsTable, parquetFileList(files),
+		)
+	}
 
-	span.SetTag("db.statement", query)
+	span.SetAttributes(dbSystem, attribute.String("db.statement", query))
 
 	return r.getStrings(ctx, query)
 }
@@ -172,18 +291,30 @@ func (r *TraceReader) GetOperations(
 	ctx context.Context,
 	params spanstore.OperationQueryParameters,
 ) ([]spanstore.Operation, error) {
-	span, ctx := opentracing.StartSpanFromContext(ctx, "GetOperations")
-	defer span.Finish()
+	ctx, span := r.tracer.Start(ctx, "GetOperations")
+	defer span.End()
 
 	if r.operationsTable == "" {
 		return nil, errNoOperationsTable
 	}
 
+	files, err := r.parquetFiles(ctx, r.indexTable, time.Time{}, time.Time{})
+	if err != nil {
+		return nil, err
+	}
+
 	query := fmt.Sprintf("SELECT operation FROM %s WHERE service = ? GROUP BY operation", r.operationsTable)
 	args := []interface{}{params.ServiceName}
+	if len(files) > 0 {
+		query = fmt.Sprintf(
+			"SELECT operation FROM %s WHERE service = ? UNION SELECT operation FROM read_parquet(%s) WHERE service = ?",
+			r.operationsTable, parquetFileList(files),
+		)
+		args = append(args, params.ServiceName)
+	}
 
-	span.SetTag("db.statement", query)
-	span.SetTag("db.args", args)
+	span.SetAttributes(dbSystem, attribute.String("db.statement", query))
+	span.SetAttributes(attribute.String("db.args", fmt.Sprint(args)))
 
 	names, err := r.getStrings(ctx, query, args...)
 	if err != nil {
@@ -199,8 +330,8 @@ func (r *TraceReader) GetOperations(
 }
 
 func (r *TraceReader) FindTraces(ctx context.Context, query *spanstore.TraceQueryParameters) ([]*model.Trace, error) {
-	span, ctx := opentracing.StartSpanFromContext(ctx, "FindTraces")
-	defer span.Finish()
+	ctx, span := r.tracer.Start(ctx, "FindTraces")
+	defer span.End()
 
 	traceIDs, err := r.FindTraceIDs(ctx, query)
 	if err != nil {
@@ -210,9 +341,21 @@ func (r *TraceReader) FindTraces(ctx context.Context, query *spanstore.TraceQuer
 	return r.getTraces(ctx, traceIDs)
 }
 
+// numTraces returns the number of traces to search for, defaultNumTraces when the query leaves it unset
+func numTraces(params *spanstore.TraceQueryParameters) int {
+	if params.NumTraces <= 0 {
+		return defaultNumTraces
+	}
+	return params.NumTraces
+}
+
+// FindTraceIDs searches the index backwards from the end of the time range, one window at a time,
+// until enough traces are found. Windows are sized from the number of index rows per hour so that
+// each query scans about as many rows as it should need, whatever the traffic at that time.
+// Traces are returned most recent start first.
 func (r *TraceReader) FindTraceIDs(ctx context.Context, params *spanstore.TraceQueryParameters) ([]model.TraceID, error) {
-	span, ctx := opentracing.StartSpanFromContext(ctx, "FindTraceIDs")
-	defer span.Finish()
+	ctx, span := r.tracer.Start(ctx, "FindTraceIDs")
+	defer span.End()
 
 	if params.StartTimeMin.IsZero() {
 		return nil, errStartTimeRequired
@@ -223,71 +366,170 @@ func (r *TraceReader) FindTraceIDs(ctx context.Context, params *spanstore.TraceQ
 		end = time.Now()
 	}
 
-	fullTimeSpan := end.Sub(params.StartTimeMin)
+	limit := numTraces(params)
 
-	if fullTimeSpan < minTimespanForProgressiveSearch+minTimespanForProgressiveSearchMargin {
-		return r.findTraceIDsInRange(ctx, params, params.StartTimeMin, end, nil)
+	if end.Sub(params.StartTimeMin) < minTimespanForProgressiveSearch+minTimespanForProgressiveSearchMargin {
+		return r.findTraceIDsInRange(ctx, params, params.StartTimeMin, end, limit)
 	}
 
-	timeSpan := fullTimeSpan
-	for step := 0; step < maxProgressiveSteps; step++ {
-		timeSpan /= 2
+	hours, err := r.hourlyRowCounts(ctx, params, params.StartTimeMin, end)
+	if err != nil {
+		return nil, err
 	}
 
-	if timeSpan < minTimespanForProgressiveSearch {
-		timeSpan = minTimespanForProgressiveSearch
+	// Rows exported to Parquet before the stats table existed are not counted in it
+	if len(hours) == 0 {
+		return r.findTraceIDsInRange(ctx, params, params.StartTimeMin, end, limit)
 	}
 
-	found := make([]model.TraceID, 0)
+	found := make([]model.TraceID, 0, limit)
+	seen := make(map[model.TraceID]struct{}, limit)
+	rowsPerTrace := int64(initialRowsPerTrace)
+	windows := 0
 
-	for step := 0; step < maxProgressiveSteps; step++ {
-		if len(found) >= params.NumTraces {
-			break
-		}
+	for next := 0; next < len(hours) && len(found) < limit; windows++ {
+		remaining := limit - len(found)
 
-		// last step has to take care of the whole remainder
-		if step == maxProgressiveSteps-1 {
-			timeSpan = fullTimeSpan
+		// Extend the window by whole hours until it holds enough rows for the remaining traces
+		var rows int64
+		for next < len(hours) && rows < int64(remaining)*rowsPerTrace {
+			rows += hours[next].rows
+			next++
 		}
 
-		start := end.Add(-timeSpan)
-		if start.Before(params.StartTimeMin) {
+		start := hours[next-1].hour
+		if next == len(hours) || start.Before(params.StartTimeMin) {
 			start = params.StartTimeMin
 		}
 
-		if start.After(end) {
-			break
-		}
-
-		foundInRange, err := r.findTraceIDsInRange(ctx, params, start, end, found)
+		foundInRange, err := r.findTraceIDsInRange(ctx, params, start, end, remaining)
 		if err != nil {
 			return nil, err
 		}
 
-		found = append(found, foundInRange...)
+		// Spans of a trace that spans the window boundary are found on both sides of it
+		added := 0
+		for _, traceID := range foundInRange {
+			if _, ok := seen[traceID]; !ok {
+				seen[traceID] = struct{}{}
+				found = append(found, traceID)
+				added++
+			}
+		}
+
+		// Few rows matching the other conditions means bigger windows are needed
+		if added == 0 {
+			rowsPerTrace *= rowsPerTraceGrowth
+		} else if observed := (rows + int64(added) - 1) / int64(added); observed > rowsPerTrace {
+			rowsPerTrace = observed
+		}
 
 		end = start
-		timeSpan *= 2
 	}
 
+	span.SetAttributes(attribute.Int("windows", windows))
+
 	return found, nil
 }
 
-func (r *TraceReader) findTraceIDsInRange(ctx context.Context, params *spanstore.TraceQueryParameters, start, end time.Time, skip []model.TraceID) ([]model.TraceID, error) {
-	span, ctx := opentracing.StartSpanFromContext(ctx, "findTraceIDsInRange")
-	defer span.Finish()
+// hourRows is the number of index rows within an hour
+type hourRows struct {
+	hour time.Time
+	rows int64
+}
+
+// hourlyRowCounts returns the number of index rows of the service and operation searched for per hour
+// within [start, end], most recent hour first. Hours without rows are left out. The counts are read
+// from the stats table if there is one, and counted from the index otherwise, which is much slower.
+func (r *TraceReader) hourlyRowCounts(ctx context.Context, params *spanstore.TraceQueryParameters, start, end time.Time) ([]hourRows, error) {
+	ctx, span := r.tracer.Start(ctx, "hourlyRowCounts")
+	defer span.End()
+
+	if r.indexTable == "" {
+		return nil, errNoIndexTable
+	}
+
+	// The stats table holds the hours themselves, its rows are added up instead of counted
+	source, hour, count, timestamp := r.statsTable, "hour", "sum(rowCount)::BIGINT", "hour"
+	if r.statsTable == "" {
+		var err error
+		if source, err = r.tableSource(ctx, r.indexTable, indexColumns, start, end); err != nil {
+			return nil, err
+		}
+		hour, count, timestamp = "date_trunc('hour', timestamp)", "count(*)", "timestamp"
+	} else {
+		start = start.Truncate(time.Hour)
+	}
+
+	query := fmt.Sprintf("SELECT %s AS hour, %s FROM %s WHERE service = ?", hour, count, source)
+	args := []interface{}{params.ServiceName}
+
+	if params.OperationName != "" {
+		query += " AND operation = ?"
+		args = append(args, params.OperationName)
+	}
+
+	query += fmt.Sprintf(" AND %s >= ? AND %s <= ? GROUP BY hour ORDER BY hour DESC", timestamp, timestamp)
+	args = append(args, start, end)
+
+	span.SetAttributes(dbSystem, attribute.String("db.statement", query))
+	span.SetAttributes(attribute.String("db.args", fmt.Sprint(args)))
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var hours []hourRows
+	for rows.Next() {
+		var h hourRows
+		if err := rows.Scan(&h.hour, &h.rows); err != nil {
+			return nil, err
+		}
+		hours = append(hours, h)
+	}
+
+	return hours, rows.Err()
+}
+
+func (r *TraceReader) findTraceIDsInRange(ctx context.Context, params *spanstore.TraceQueryParameters, start, end time.Time, limit int) ([]model.TraceID, error) {
+	ctx, span := r.tracer.Start(ctx, "findTraceIDsInRange")
+	defer span.End()
 
 	if end.Before(start) || end == start {
 		return []model.TraceID{}, nil
 	}
 
-	span.SetTag("range", end.Sub(start).String())
+	span.SetAttributes(attribute.String("range", end.Sub(start).String()))
 
+	query, args, err := r.searchQuery(ctx, params, start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	query += " GROUP BY traceID ORDER BY min(timestamp) DESC LIMIT ?"
+	args = append(args, limit)
+
+	span.SetAttributes(dbSystem, attribute.String("db.statement", query))
+	span.SetAttributes(attribute.String("db.args", fmt.Sprint(args)))
+
+	return r.getTraceIDs(ctx, query, args...)
+}
+
+// searchQuery returns the query selecting the trace IDs of the index rows matching params within
+// [start, end], for the caller to add the grouping, ordering and limit to.
+func (r *TraceReader) searchQuery(ctx context.Context, params *spanstore.TraceQueryParameters, start, end time.Time) (string, []interface{}, error) {
 	if r.indexTable == "" {
-		return nil, errNoIndexTable
+		return "", nil, errNoIndexTable
+	}
+
+	source, err := r.tableSource(ctx, r.indexTable, indexColumns, start, end)
+	if err != nil {
+		return "", nil, err
 	}
 
-	query := fmt.Sprintf("SELECT DISTINCT traceID FROM %s WHERE service = ?", r.indexTable)
+	query := fmt.Sprintf("SELECT traceID FROM %s WHERE service = ?", source)
 	args := []interface{}{params.ServiceName}
 
 	if params.OperationName != "" {
@@ -301,34 +543,52 @@ func (r *TraceReader) findTraceIDsInRange(ctx context.Context, params *spanstore
 	query += " AND timestamp <= ?"
 	args = append(args, end)
 
+	durationQuery, durationArgs := r.durationFilter(params, start, end)
+	query += durationQuery
+	args = append(args, durationArgs...)
+
+	for key, value := range params.Tags {
+		query += " AND list_contains(tags, ?)"
+		args = append(args, fmt.Sprintf("%s=%s", key, value))
+	}
+
+	return query, args, nil
+}
+
+// durationFilter returns the conditions on the duration of the search query. The index rows are
+// filtered on the duration of their span, or with traceDurations on the whole duration of their
+// trace. The traces having a row within [start, end] start before end and end after start.
+func (r *TraceReader) durationFilter(params *spanstore.TraceQueryParameters, start, end time.Time) (string, []interface{}) {
+	if params.DurationMin == 0 && params.DurationMax == 0 {
+		return "", nil
+	}
+
+	var conditions []string
+	var args []interface{}
+
+	if r.traceDurations {
+		conditions = append(conditions, "startTime <= ?", "endTime >= ?")
+		args = append(args, end, start)
+	}
+
 	if params.DurationMin != 0 {
-		query += " AND durationUs >= ?"
+		conditions = append(conditions, "durationUs >= ?")
 		args = append(args, params.DurationMin.Microseconds())
 	}
 
 	if params.DurationMax != 0 {
-		query += " AND durationUs <= ?"
+		conditions = append(conditions, "durationUs <= ?")
 		args = append(args, params.DurationMax.Microseconds())
 	}
 
-	for key, value := range params.Tags {
-		query += " AND has(tags, ?)"
-		args = append(args, fmt.Sprintf("%s=%s", key, value))
+	if !r.traceDurations {
+		return " AND " + strings.Join(conditions, " AND "), args
 	}
 
-	if len(skip) > 0 {
-		query += fmt.Sprintf(" AND traceID NOT IN (%s)", "?"+strings.Repeat(",?", len(skip)-1))
-		for _, traceID := range skip {
-			args = append(args, traceID.String())
-		}
-	}
-
-	query += " ORDER BY service, timestamp DESC LIMIT ?"
-	args = append(args, params.NumTraces-len(skip))
-
-	span.SetTag("db.statement", query)
-	span.SetTag("db.args", args)
+	return fmt.Sprintf(" AND traceID IN (SELECT traceID FROM %s WHERE %s)", r.tracesTable, strings.Join(conditions, " AND ")), args
+}
 
+func (r *TraceReader) getTraceIDs(ctx context.Context, query string, args ...interface{}) ([]model.TraceID, error) {
 	traceIDStrings, err := r.getStrings(ctx, query, args...)
 	if err != nil {
 		return nil, err
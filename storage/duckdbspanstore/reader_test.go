@@ -0,0 +1,455 @@
+package duckdbspanstore
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	hclog "github.com/hashicorp/go-hclog"
+	"github.com/jaegertracing/jaeger/model"
+	"github.com/jaegertracing/jaeger/storage/spanstore"
+	_ "github.com/marcboeker/go-duckdb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const testFilesTable = "jaeger_parquet_files"
+
+func newTestDB(t *testing.T, statements ...string) *sql.DB {
+	db, err := sql.Open("duckdb", "")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = db.Close() })
+
+	for _, statement := range statements {
+		_, err := db.Exec(statement)
+		require.NoError(t, err)
+	}
+
+	return db
+}
+
+func TestTraceReader_parquetFiles(t *testing.T) {
+	db := newTestDB(t,
+		"CREATE TABLE jaeger_parquet_files (path String, tableName String, minTimestamp Timestamp, maxTimestamp Timestamp, rowCount UInt64, exportedAt Timestamp)",
+		"INSERT INTO jaeger_parquet_files VALUES ('/cold/index-1.parquet', 'jaeger_index', '2022-01-01 00:00:00', '2022-01-01 23:59:59', 10, now())",
+		"INSERT INTO jaeger_parquet_files VALUES ('/cold/index-2.parquet', 'jaeger_index', '2022-01-02 00:00:00', '2022-01-02 23:59:59', 10, now())",
+		"INSERT INTO jaeger_parquet_files VALUES ('/cold/spans-1.parquet', 'jaeger_spans', '2022-01-01 00:00:00', '2022-01-01 23:59:59', 10, now())",
+	)
+	day := func(d int) time.Time { return time.Date(2022, 1, d, 12, 0, 0, 0, time.UTC) }
+
+	tests := []struct {
+		name       string
+		filesTable string
+		table      string
+		start      time.Time
+		end        time.Time
+		expected   []string
+	}{
+		{name: "no files table", table: "jaeger_index"},
+		{name: "unbounded", filesTable: testFilesTable, table: "jaeger_index", expected: []string{"/cold/index-1.parquet", "/cold/index-2.parquet"}},
+		{name: "first day", filesTable: testFilesTable, table: "jaeger_index", start: day(1), end: day(1), expected: []string{"/cold/index-1.parquet"}},
+		{name: "after second day", filesTable: testFilesTable, table: "jaeger_index", start: day(3), end: day(4), expected: []string{}},
+		{name: "other table", filesTable: testFilesTable, table: "jaeger_spans", start: day(1), expected: []string{"/cold/spans-1.parquet"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			reader := NewTraceReader(db, "jaeger_index", "", "jaeger_operations", "jaeger_spans", "", test.filesTable, false, trace.NewNoopTracerProvider())
+			files, err := reader.parquetFiles(context.Background(), test.table, test.start, test.end)
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, files)
+		})
+	}
+}
+
+func TestTraceReader_tableSource(t *testing.T) {
+	db := newTestDB(t,
+		"CREATE TABLE jaeger_parquet_files (path String, tableName String, minTimestamp Timestamp, maxTimestamp Timestamp, rowCount UInt64, exportedAt Timestamp)",
+		"INSERT INTO jaeger_parquet_files VALUES ('/cold/it''s.parquet', 'jaeger_spans', '2022-01-01 00:00:00', '2022-01-01 23:59:59', 10, now())",
+	)
+	reader := NewTraceReader(db, "jaeger_index", "", "jaeger_operations", "jaeger_spans", "", testFilesTable, false, trace.NewNoopTracerProvider())
+
+	source, err := reader.tableSource(context.Background(), "jaeger_index", indexColumns, time.Time{}, time.Time{})
+	require.NoError(t, err)
+	assert.Equal(t, "jaeger_index", source)
+
+	source, err = reader.tableSource(context.Background(), "jaeger_spans", spansColumns, time.Time{}, time.Time{})
+	require.NoError(t, err)
+	assert.Equal(t, "(SELECT timestamp, traceID, model FROM jaeger_spans UNION ALL SELECT timestamp, traceID, model FROM read_parquet(['/cold/it''s.parquet'])) AS jaeger_spans", source)
+}
+
+func TestTraceReader_parquetRoundTrip(t *testing.T) {
+	start := time.Date(2022, 1, 1, 10, 0, 0, 0, time.UTC)
+	writer := newExportTestWriter(t, start, 10)
+	db := writer.db
+	_, err := db.Exec("CREATE VIEW jaeger_operations AS SELECT CAST(timestamp AS DATE) AS date, service, operation, count() AS count FROM jaeger_index GROUP BY date, service, operation")
+	require.NoError(t, err)
+
+	// The GET spans and the first POST span move to Parquet files, the other POST spans stay live
+	exporter := NewParquetExporter(hclog.NewNullLogger(), db, "jaeger_index", "jaeger_spans", testFilesTable, t.TempDir())
+	files, err := exporter.Export(context.Background(), start, start.Add(6*time.Minute))
+	require.NoError(t, err)
+	require.Len(t, files, 2)
+
+	reader := NewTraceReader(db, "jaeger_index", "", "jaeger_operations", "jaeger_spans", "", testFilesTable, false, trace.NewNoopTracerProvider())
+	ctx := context.Background()
+
+	services, err := reader.GetServices(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"frontend"}, services)
+
+	operations, err := reader.GetOperations(ctx, spanstore.OperationQueryParameters{ServiceName: "frontend"})
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []spanstore.Operation{{Name: "GET /"}, {Name: "POST /"}}, operations)
+
+	traceIDs, err := reader.FindTraceIDs(ctx, &spanstore.TraceQueryParameters{
+		ServiceName:   "frontend",
+		OperationName: "POST /",
+		StartTimeMin:  start,
+		StartTimeMax:  start.Add(time.Hour),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []model.TraceID{
+		model.NewTraceID(0, 10),
+		model.NewTraceID(0, 9),
+		model.NewTraceID(0, 8),
+		model.NewTraceID(0, 7),
+		model.NewTraceID(0, 6),
+	}, traceIDs)
+
+	for _, id := range []uint64{1, 10} {
+		trace, err := reader.GetTrace(ctx, model.NewTraceID(0, id))
+		require.NoError(t, err)
+		require.Len(t, trace.Spans, 1)
+		assert.Equal(t, start.Add(time.Duration(id-1)*time.Minute), trace.Spans[0].StartTime.UTC())
+	}
+}
+
+// searchDatasetEnd is the end of the time range covered by the synthetic search datasets
+var searchDatasetEnd = time.Date(2022, 1, 3, 0, 0, 0, 0, time.UTC)
+
+// searchDataset describes synthetic index rows, five spans per trace, spread over the two days
+// before searchDatasetEnd. timestamp is an SQL expression of the row number i among rows.
+type searchDataset struct {
+	name      string
+	rows      int
+	timestamp string
+}
+
+var searchDatasets = []searchDataset{
+	{
+		name:      "uniform",
+		rows:      200_000,
+		timestamp: "to_timestamp(%[1]d - i * 172800 / %[2]d)",
+	},
+	{
+		// one row in a hundred is in the last day, the rest is in the day before
+		name:      "quiet recent day",
+		rows:      200_000,
+		timestamp: "to_timestamp(CASE WHEN i %% 100 = 0 THEN %[1]d - i * 86400 / %[2]d ELSE %[1]d - 86400 - i * 86400 / %[2]d END)",
+	},
+}
+
+func newSearchTestDB(tb testing.TB, dataset searchDataset) *sql.DB {
+	db, err := sql.Open("duckdb", "")
+	require.NoError(tb, err)
+	tb.Cleanup(func() { _ = db.Close() })
+
+	for _, statement := range []string{
+		"CREATE TABLE jaeger_index (timestamp Timestamp, traceID String, service String, operation String, durationUs UInt64, tags String[])",
+		fmt.Sprintf(
+			"INSERT INTO jaeger_index SELECT %s, printf('%%x', i / 5 + 1), 'frontend', 'GET /', i %% 1000, ['status=' || (i %% 100)::VARCHAR] FROM range(0, %d) AS t(i)",
+			fmt.Sprintf(dataset.timestamp, searchDatasetEnd.Unix(), dataset.rows), dataset.rows,
+		),
+		"CREATE TABLE jaeger_index_stats AS SELECT date_trunc('hour', timestamp) AS hour, service, operation, count(*) AS rowCount FROM jaeger_index GROUP BY hour, service, operation",
+	} {
+		_, err := db.Exec(statement)
+		require.NoError(tb, err)
+	}
+
+	return db
+}
+
+// searchQueries are searches over the whole range of the synthetic datasets
+var searchQueries = []struct {
+	name   string
+	params spanstore.TraceQueryParameters
+}{
+	{name: "service", params: spanstore.TraceQueryParameters{ServiceName: "frontend"}},
+	{name: "selective tag", params: spanstore.TraceQueryParameters{ServiceName: "frontend", Tags: map[string]string{"status": "42"}}},
+	{name: "no match", params: spanstore.TraceQueryParameters{ServiceName: "frontend", DurationMin: time.Hour}},
+}
+
+func searchParams(params spanstore.TraceQueryParameters) *spanstore.TraceQueryParameters {
+	params.StartTimeMin = searchDatasetEnd.Add(-48 * time.Hour)
+	params.StartTimeMax = searchDatasetEnd
+	params.NumTraces = 20
+	return &params
+}
+
+func TestTraceReader_FindTraceIDs_adaptive(t *testing.T) {
+	for _, dataset := range searchDatasets {
+		db := newSearchTestDB(t, dataset)
+
+		for _, statsTable := range []string{"jaeger_index_stats", ""} {
+			reader := NewTraceReader(db, "jaeger_index", statsTable, "", "", "", "", false, trace.NewNoopTracerProvider())
+
+			for _, query := range searchQueries {
+				t.Run(fmt.Sprintf("%s/%s/stats table %q", dataset.name, query.name, statsTable), func(t *testing.T) {
+					params := searchParams(query.params)
+					ctx := context.Background()
+
+					all, err := reader.findTraceIDsInRange(ctx, params, params.StartTimeMin, params.StartTimeMax, dataset.rows)
+					require.NoError(t, err)
+
+					found, err := reader.FindTraceIDs(ctx, params)
+					require.NoError(t, err)
+
+					expected := params.NumTraces
+					if len(all) < expected {
+						expected = len(all)
+					}
+					assert.Len(t, found, expected)
+					assert.Subset(t, all, found)
+				})
+			}
+		}
+	}
+}
+
+func TestTraceReader_FindTraceIDs_ordering(t *testing.T) {
+	// Trace i starts i*4 minutes before the end of the dataset and has a second span 30 seconds
+	// later, so the 150 traces cover 10 hours, enough for several search windows. Every tenth trace
+	// is tagged to make searches that need more than one window.
+	db := newTestDB(t,
+		"CREATE TABLE jaeger_index (timestamp Timestamp, traceID String, service String, operation String, durationUs UInt64, tags String[])",
+		fmt.Sprintf(
+			"INSERT INTO jaeger_index SELECT to_timestamp(%d - i * 240 + s * 30), printf('%%x', i), 'frontend', 'GET /', 0, CASE WHEN i %% 10 = 0 THEN ['tenth=true'] ELSE [] END FROM range(1, 151) AS t(i), range(0, 2) AS u(s)",
+			searchDatasetEnd.Unix(),
+		),
+		"CREATE TABLE jaeger_index_stats AS SELECT date_trunc('hour', timestamp) AS hour, service, operation, count(*) AS rowCount FROM jaeger_index GROUP BY hour, service, operation",
+	)
+
+	traceIDs := func(from, to, step int) []model.TraceID {
+		var traceIDs []model.TraceID
+		for i := from; i <= to; i += step {
+			traceIDs = append(traceIDs, model.NewTraceID(0, uint64(i)))
+		}
+		return traceIDs
+	}
+
+	tests := []struct {
+		name      string
+		numTraces int
+		start     time.Time
+		tags      map[string]string
+		expected  []model.TraceID
+	}{
+		{name: "single window", numTraces: 5, start: searchDatasetEnd.Add(-time.Hour), expected: traceIDs(1, 5, 1)},
+		{name: "default limit in a single window", start: searchDatasetEnd.Add(-time.Hour), expected: traceIDs(1, 15, 1)},
+		{name: "limit within the first window", numTraces: 7, start: searchDatasetEnd.Add(-12 * time.Hour), expected: traceIDs(1, 7, 1)},
+		{name: "limit beyond the first window", numTraces: 120, start: searchDatasetEnd.Add(-12 * time.Hour), expected: traceIDs(1, 120, 1)},
+		{name: "default limit", start: searchDatasetEnd.Add(-12 * time.Hour), expected: traceIDs(1, defaultNumTraces, 1)},
+		{name: "fewer traces than the limit", numTraces: 1000, start: searchDatasetEnd.Add(-12 * time.Hour), expected: traceIDs(1, 150, 1)},
+		{name: "range start", numTraces: 1000, start: searchDatasetEnd.Add(-5 * time.Hour), expected: traceIDs(1, 75, 1)},
+		{name: "limit across windows", numTraces: 3, start: searchDatasetEnd.Add(-12 * time.Hour), tags: map[string]string{"tenth": "true"}, expected: traceIDs(10, 30, 10)},
+		{name: "default limit across windows", start: searchDatasetEnd.Add(-12 * time.Hour), tags: map[string]string{"tenth": "true"}, expected: traceIDs(10, 150, 10)},
+	}
+
+	for _, statsTable := range []string{"jaeger_index_stats", ""} {
+		reader := NewTraceReader(db, "jaeger_index", statsTable, "", "", "", "", false, trace.NewNoopTracerProvider())
+
+		for _, test := range tests {
+			t.Run(fmt.Sprintf("%s/stats table %q", test.name, statsTable), func(t *testing.T) {
+				found, err := reader.FindTraceIDs(context.Background(), &spanstore.TraceQueryParameters{
+					ServiceName:  "frontend",
+					StartTimeMin: test.start,
+					StartTimeMax: searchDatasetEnd,
+					NumTraces:    test.numTraces,
+					Tags:         test.tags,
+				})
+				require.NoError(t, err)
+				assert.Equal(t, test.expected, found)
+			})
+		}
+	}
+}
+
+func TestTraceReader_FindTraceIDs_traceDuration(t *testing.T) {
+	// Trace 1 lasts 2 seconds made of short spans, trace 2 is a single span of a second
+	db := newTestDB(t,
+		"CREATE TABLE jaeger_index (timestamp Timestamp, traceID String, service String, operation String, durationUs UInt64, tags String[])",
+		"INSERT INTO jaeger_index VALUES ('2022-01-01 10:00:00', '1', 'frontend', 'GET /', 1000, []), ('2022-01-01 10:00:02', '1', 'frontend', 'GET /', 1000, [])",
+		"INSERT INTO jaeger_index VALUES ('2022-01-01 10:00:00', '2', 'frontend', 'GET /', 1000000, [])",
+		"CREATE TABLE jaeger_traces (traceID String, startTime Timestamp, endTime Timestamp, durationUs UInt64, spanCount UInt64, rootService String, rootOperation String, hasError Boolean)",
+		"INSERT INTO jaeger_traces VALUES ('1', '2022-01-01 10:00:00', '2022-01-01 10:00:02.001', 2001000, 2, 'frontend', 'GET /', false)",
+		"INSERT INTO jaeger_traces VALUES ('2', '2022-01-01 10:00:00', '2022-01-01 10:00:01', 1000000, 1, 'frontend', 'GET /', false)",
+	)
+
+	tests := []struct {
+		name           string
+		traceDurations bool
+		durationMin    time.Duration
+		durationMax    time.Duration
+		expected       []model.TraceID
+	}{
+		{name: "span duration", durationMin: 500 * time.Millisecond, expected: []model.TraceID{model.NewTraceID(0, 2)}},
+		{name: "trace duration", traceDurations: true, durationMin: 1500 * time.Millisecond, expected: []model.TraceID{model.NewTraceID(0, 1)}},
+		{name: "trace duration range", traceDurations: true, durationMin: 500 * time.Millisecond, durationMax: 1500 * time.Millisecond, expected: []model.TraceID{model.NewTraceID(0, 2)}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			reader := NewTraceReader(db, "jaeger_index", "", "", "", "jaeger_traces", "", test.traceDurations, trace.NewNoopTracerProvider())
+			found, err := reader.FindTraceIDs(context.Background(), &spanstore.TraceQueryParameters{
+				ServiceName:  "frontend",
+				StartTimeMin: time.Date(2022, 1, 1, 9, 30, 0, 0, time.UTC),
+				StartTimeMax: time.Date(2022, 1, 1, 10, 30, 0, 0, time.UTC),
+				DurationMin:  test.durationMin,
+				DurationMax:  test.durationMax,
+			})
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, found)
+		})
+	}
+}
+
+func TestTraceReader_FindTraceSummaries(t *testing.T) {
+	// Trace 1 has a full summary, trace 2 was backfilled from the index and trace 3 has no summary
+	db := newTestDB(t,
+		"CREATE TABLE jaeger_index (timestamp Timestamp, traceID String, service String, operation String, durationUs UInt64, tags String[])",
+		"INSERT INTO jaeger_index VALUES ('2022-01-01 10:00:00', '1', 'backend', 'SELECT', 2000000, ['error=true'])",
+		"INSERT INTO jaeger_index VALUES ('2022-01-01 10:05:00', '2', 'backend', 'SELECT', 1000000, [])",
+		"INSERT INTO jaeger_index VALUES ('2022-01-01 10:10:00', '3', 'backend', 'SELECT', 1000000, [])",
+		"CREATE TABLE jaeger_traces (traceID String, startTime Timestamp, endTime Timestamp, durationUs UInt64, spanCount UInt64, rootService String, rootOperation String, hasError Boolean, services String[], errorCount UInt64)",
+		"INSERT INTO jaeger_traces VALUES ('0000000000000001', '2022-01-01 09:59:59.5', '2022-01-01 10:00:02', 2500000, 2, 'frontend', 'GET /', true, ['backend', 'frontend'], 1)",
+		"INSERT INTO jaeger_traces (traceID, startTime, endTime, durationUs, spanCount, hasError) VALUES ('0000000000000002', '2022-01-01 10:05:00', '2022-01-01 10:05:01', 1000000, 1, false)",
+	)
+	query := &spanstore.TraceQueryParameters{
+		ServiceName:  "backend",
+		StartTimeMin: time.Date(2022, 1, 1, 9, 30, 0, 0, time.UTC),
+		StartTimeMax: time.Date(2022, 1, 1, 10, 30, 0, 0, time.UTC),
+	}
+
+	reader := NewTraceReader(db, "jaeger_index", "", "", "", "jaeger_traces", "", false, trace.NewNoopTracerProvider())
+	summaries, err := reader.FindTraceSummaries(context.Background(), query)
+	require.NoError(t, err)
+	assert.Equal(t, []TraceSummary{
+		{
+			TraceID:   model.NewTraceID(0, 2),
+			StartTime: time.Date(2022, 1, 1, 10, 5, 0, 0, time.UTC),
+			Duration:  time.Second,
+			SpanCount: 1,
+			Services:  []string{},
+		},
+		{
+			TraceID:       model.NewTraceID(0, 1),
+			StartTime:     time.Date(2022, 1, 1, 9, 59, 59, 500_000_000, time.UTC),
+			Duration:      2500 * time.Millisecond,
+			RootService:   "frontend",
+			RootOperation: "GET /",
+			SpanCount:     2,
+			Services:      []string{"backend", "frontend"},
+			ErrorCount:    1,
+		},
+	}, summaries)
+
+	query.ServiceName = "frontend"
+	summaries, err = reader.FindTraceSummaries(context.Background(), query)
+	require.NoError(t, err)
+	assert.Empty(t, summaries)
+
+	reader = NewTraceReader(db, "jaeger_index", "", "", "", "", "", false, trace.NewNoopTracerProvider())
+	_, err = reader.FindTraceSummaries(context.Background(), query)
+	assert.ErrorIs(t, err, errNoTracesTable)
+}
+
+// fixedStepsFindTraceIDs is the search FindTraceIDs used to run: four windows doubling in size
+// from a sixteenth of the range, skipping the traces found in the previous ones with NOT IN.
+func fixedStepsFindTraceIDs(ctx context.Context, r *TraceReader, params *spanstore.TraceQueryParameters) ([]model.TraceID, error) {
+	const steps = 4
+
+	end := params.StartTimeMax
+	fullTimeSpan := end.Sub(params.StartTimeMin)
+
+	timeSpan := fullTimeSpan
+	for step := 0; step < steps; step++ {
+		timeSpan /= 2
+	}
+	if timeSpan < minTimespanForProgressiveSearch {
+		timeSpan = minTimespanForProgressiveSearch
+	}
+
+	found := make([]model.TraceID, 0)
+	for step := 0; step < steps && len(found) < params.NumTraces; step++ {
+		if step == steps-1 {
+			timeSpan = fullTimeSpan
+		}
+
+		start := end.Add(-timeSpan)
+		if start.Before(params.StartTimeMin) {
+			start = params.StartTimeMin
+		}
+
+		query, args, err := r.searchQuery(ctx, params, start, end)
+		if err != nil {
+			return nil, err
+		}
+		if len(found) > 0 {
+			query += fmt.Sprintf(" AND traceID NOT IN (%s)", "?"+strings.Repeat(",?", len(found)-1))
+			for _, traceID := range found {
+				args = append(args, traceID.String())
+			}
+		}
+		query += " GROUP BY traceID ORDER BY min(timestamp) DESC LIMIT ?"
+		args = append(args, params.NumTraces-len(found))
+
+		foundInRange, err := r.getTraceIDs(ctx, query, args...)
+		if err != nil {
+			return nil, err
+		}
+		found = append(found, foundInRange...)
+
+		end = start
+		timeSpan *= 2
+	}
+
+	return found, nil
+}
+
+func BenchmarkTraceReader_FindTraceIDs(b *testing.B) {
+	for _, dataset := range searchDatasets {
+		db := newSearchTestDB(b, dataset)
+		reader := NewTraceReader(db, "jaeger_index", "jaeger_index_stats", "", "", "", "", false, trace.NewNoopTracerProvider())
+		withoutStats := NewTraceReader(db, "jaeger_index", "", "", "", "", "", false, trace.NewNoopTracerProvider())
+
+		for _, query := range searchQueries {
+			params := searchParams(query.params)
+
+			b.Run(dataset.name+"/"+query.name+"/adaptive", func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					_, err := reader.FindTraceIDs(context.Background(), params)
+					require.NoError(b, err)
+				}
+			})
+
+			b.Run(dataset.name+"/"+query.name+"/adaptive without stats table", func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					_, err := withoutStats.FindTraceIDs(context.Background(), params)
+					require.NoError(b, err)
+				}
+			})
+
+			b.Run(dataset.name+"/"+query.name+"/fixed steps", func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					_, err := fixedStepsFindTraceIDs(context.Background(), reader, params)
+					require.NoError(b, err)
+				}
+			})
+		}
+	}
+}
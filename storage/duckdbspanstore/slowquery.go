@@ -0,0 +1,84 @@
+package duckdbspanstore
+
+import (
+	"context"
+	"time"
+
+	hclog "github.com/hashicorp/go-hclog"
+	"github.com/jaegertracing/jaeger/model"
+	"github.com/jaegertracing/jaeger/storage/spanstore"
+)
+
+// SlowQueryLogDecorator wraps a spanstore.Reader and logs the queries that take
+// longer than a threshold, along with their parameters.
+type SlowQueryLogDecorator struct {
+	reader    spanstore.Reader
+	logger    hclog.Logger
+	threshold time.Duration
+}
+
+var _ spanstore.Reader = (*SlowQueryLogDecorator)(nil)
+
+func NewSlowQueryLogDecorator(reader spanstore.Reader, logger hclog.Logger, threshold time.Duration) *SlowQueryLogDecorator {
+	return &SlowQueryLogDecorator{
+		reader:    reader,
+		logger:    logger,
+		threshold: threshold,
+	}
+}
+
+func (d *SlowQueryLogDecorator) log(query string, start time.Time, args ...interface{}) {
+	elapsed := time.Since(start)
+	if elapsed < d.threshold {
+		return
+	}
+	d.logger.Warn("Slow query", append([]interface{}{"query", query, "duration", elapsed.String()}, args...)...)
+}
+
+func (d *SlowQueryLogDecorator) GetTrace(ctx context.Context, traceID model.TraceID) (*model.Trace, error) {
+	start := time.Now()
+	trace, err := d.reader.GetTrace(ctx, traceID)
+	d.log("get_trace", start, "trace_id", traceID.String())
+	return trace, err
+}
+
+func (d *SlowQueryLogDecorator) GetServices(ctx context.Context) ([]string, error) {
+	start := time.Now()
+	services, err := d.reader.GetServices(ctx)
+	d.log("get_services", start)
+	return services, err
+}
+
+func (d *SlowQueryLogDecorator) GetOperations(ctx context.Context, query spanstore.OperationQueryParameters) ([]spanstore.Operation, error) {
+	start := time.Now()
+	operations, err := d.reader.GetOperations(ctx, query)
+	d.log("get_operations", start, "service", query.ServiceName, "span_kind", query.SpanKind)
+	return operations, err
+}
+
+func (d *SlowQueryLogDecorator) FindTraces(ctx context.Context, query *spanstore.TraceQueryParameters) ([]*model.Trace, error) {
+	start := time.Now()
+	traces, err := d.reader.FindTraces(ctx, query)
+	d.log("find_traces", start, traceQueryArgs(query)...)
+	return traces, err
+}
+
+func (d *SlowQueryLogDecorator) FindTraceIDs(ctx context.Context, query *spanstore.TraceQueryParameters) ([]model.TraceID, error) {
+	start := time.Now()
+	traceIDs, err := d.reader.FindTraceIDs(ctx, query)
+	d.log("find_trace_ids", start, traceQueryArgs(query)...)
+	return traceIDs, err
+}
+
+func traceQueryArgs(query *spanstore.TraceQueryParameters) []interface{} {
+	return []interface{}{
+		"service", query.ServiceName,
+		"operation", query.OperationName,
+		"tags", len(query.Tags),
+		"start_min", query.StartTimeMin,
+		"start_max", query.StartTimeMax,
+		"duration_min", query.DurationMin,
+		"duration_max", query.DurationMax,
+		"num_traces", query.NumTraces,
+	}
+}
@@ -0,0 +1,50 @@
+package duckdbspanstore
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	hclog "github.com/hashicorp/go-hclog"
+	"github.com/jaegertracing/jaeger/model"
+	"github.com/jaegertracing/jaeger/storage/spanstore"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSlowQueryLogDecorator(t *testing.T) {
+	tests := []struct {
+		name      string
+		threshold time.Duration
+		logged    bool
+	}{
+		{name: "slow", threshold: time.Nanosecond, logged: true},
+		{name: "fast", threshold: time.Hour, logged: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var output bytes.Buffer
+			logger := hclog.New(&hclog.LoggerOptions{Output: &output, JSONFormat: true})
+			reader := NewSlowQueryLogDecorator(stubReader{}, logger, test.threshold)
+
+			_, err := reader.GetTrace(context.Background(), model.NewTraceID(0, 1))
+			assert.Equal(t, errTestQuery, err)
+
+			_, err = reader.FindTraceIDs(context.Background(), &spanstore.TraceQueryParameters{
+				ServiceName: "svc",
+				Tags:        map[string]string{"user.email": "someone@example.com"},
+			})
+			assert.NoError(t, err)
+
+			if !test.logged {
+				assert.Empty(t, output.String())
+				return
+			}
+			assert.Contains(t, output.String(), `"query":"get_trace"`)
+			assert.Contains(t, output.String(), `"query":"find_trace_ids"`)
+			assert.Contains(t, output.String(), `"service":"svc"`)
+			assert.NotContains(t, output.String(), "someone@example.com")
+		})
+	}
+}
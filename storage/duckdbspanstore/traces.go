@@ -0,0 +1,268 @@
+package duckdbspanstore
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jaegertracing/jaeger/model"
+	"github.com/jaegertracing/jaeger/storage/spanstore"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// traceSummary describes the spans of a batch belonging to a trace, merged into its stored summary
+type traceSummary struct {
+	traceID       model.TraceID
+	start         time.Time
+	end           time.Time
+	spanCount     int64
+	rootService   sql.NullString
+	rootOperation sql.NullString
+	services      map[string]struct{}
+	errorCount    int64
+}
+
+func (s *traceSummary) add(span *model.Span) {
+	if s.spanCount == 0 || span.StartTime.Before(s.start) {
+		s.start = span.StartTime
+	}
+	if end := span.StartTime.Add(span.Duration); s.spanCount == 0 || end.After(s.end) {
+		s.end = end
+	}
+	s.spanCount++
+
+	if span.ParentSpanID() == 0 {
+		s.rootService = sql.NullString{String: span.Process.ServiceName, Valid: true}
+		s.rootOperation = sql.NullString{String: span.OperationName, Valid: true}
+	}
+
+	if s.services == nil {
+		s.services = make(map[string]struct{})
+	}
+	s.services[span.Process.ServiceName] = struct{}{}
+
+	if spanHasError(span) {
+		s.errorCount++
+	}
+}
+
+func (s *traceSummary) durationUs() int64 {
+	return s.end.Sub(s.start).Microseconds()
+}
+
+// serviceList returns the services of the trace sorted by name, as a list of query parameters
+// and the arguments to bind to them
+func (s *traceSummary) serviceList() (string, []interface{}) {
+	services := make([]string, 0, len(s.services))
+	for service := range s.services {
+		services = append(services, service)
+	}
+	sort.Strings(services)
+	return listParams(services)
+}
+
+// spanHasError tells whether the span is tagged with error=true
+func spanHasError(span *model.Span) bool {
+	for _, kv := range span.Tags {
+		if kv.Key != "error" {
+			continue
+		}
+		switch kv.VType {
+		case model.BoolType:
+			return kv.Bool()
+		case model.StringType:
+			return kv.VStr == "true"
+		}
+	}
+	return false
+}
+
+// writeTracesBatch merges the spans of batch into the summaries of their traces. Spans of a trace
+// arrive over several batches, a stored summary is updated in place and a summary is inserted for
+// traces seen for the first time.
+func (w *SpanWriter) writeTracesBatch(ctx context.Context, tx *sql.Tx, batch []*model.Span) error {
+	ctx, span := w.tracer.Start(ctx, "writeTracesBatch")
+	defer span.End()
+
+	span.SetAttributes(dbSystem, attribute.String("db.table", w.tracesTable))
+
+	summaries := make(map[model.TraceID]*traceSummary)
+	for _, span := range batch {
+		summary, ok := summaries[span.TraceID]
+		if !ok {
+			summary = &traceSummary{traceID: span.TraceID}
+			summaries[span.TraceID] = summary
+		}
+		summary.add(span)
+	}
+
+	for _, summary := range summaries {
+		updated, err := w.updateTraceSummary(ctx, tx, summary)
+		if err != nil {
+			return redactError(err)
+		}
+		if updated {
+			continue
+		}
+
+		if err := w.insertTraceSummary(ctx, tx, summary); err != nil {
+			return redactError(err)
+		}
+	}
+	return nil
+}
+
+// updateTraceSummary merges summary into the stored summary of its trace and tells whether there was one
+func (w *SpanWriter) updateTraceSummary(ctx context.Context, tx *sql.Tx, summary *traceSummary) (bool, error) {
+	start, end := summary.start.UTC(), summary.end.UTC()
+	services, serviceArgs := summary.serviceList()
+
+	args := []interface{}{start, end, start, end, summary.spanCount, summary.rootService, summary.rootOperation, summary.errorCount > 0}
+	args = append(args, serviceArgs...)
+	args = append(args, summary.errorCount, summary.traceID.String())
+
+	result, err := tx.ExecContext(
+		ctx,
+		fmt.Sprintf(
+			"UPDATE %s SET startTime = least(startTime, ?), endTime = greatest(endTime, ?), durationUs = date_diff('microseconds', least(startTime, ?), greatest(endTime, ?)), spanCount = spanCount + ?, rootService = coalesce(?, rootService), rootOperation = coalesce(?, rootOperation), hasError = coalesce(hasError, false) OR ?, services = list_sort(list_distinct(list_concat(coalesce(services, []::VARCHAR[]), %s))), errorCount = coalesce(errorCount, 0) + ? WHERE traceID = ?",
+			w.tracesTable, services,
+		),
+		args...,
+	)
+	if err != nil {
+		return false, err
+	}
+
+	updated, err := result.RowsAffected()
+	return updated > 0, err
+}
+
+// insertTraceSummary stores the summary of a trace seen for the first time
+func (w *SpanWriter) insertTraceSummary(ctx context.Context, tx *sql.Tx, summary *traceSummary) error {
+	services, serviceArgs := summary.serviceList()
+
+	args := []interface{}{
+		summary.traceID.String(),
+		summary.start.UTC(),
+		summary.end.UTC(),
+		summary.durationUs(),
+		summary.spanCount,
+		summary.rootService,
+		summary.rootOperation,
+		summary.errorCount > 0,
+	}
+	args = append(args, serviceArgs...)
+	args = append(args, summary.errorCount)
+
+	_, err := tx.ExecContext(
+		ctx,
+		fmt.Sprintf(
+			"INSERT INTO %s (traceID, startTime, endTime, durationUs, spanCount, rootService, rootOperation, hasError, services, errorCount) VALUES (?, ?, ?, ?, ?, ?, ?, ?, %s, ?)",
+			w.tracesTable, services,
+		),
+		args...,
+	)
+	return err
+}
+
+// stringList converts a list scanned from DuckDB to strings, a NULL list has no strings
+func stringList(value interface{}) []string {
+	list, _ := value.([]interface{})
+	strs := make([]string, 0, len(list))
+	for _, v := range list {
+		strs = append(strs, fmt.Sprint(v))
+	}
+	return strs
+}
+
+// TraceSummary describes a trace without its spans, enough to list it in search results
+type TraceSummary struct {
+	TraceID       model.TraceID
+	StartTime     time.Time
+	Duration      time.Duration
+	RootService   string
+	RootOperation string
+	SpanCount     int64
+	Services      []string
+	ErrorCount    int64
+}
+
+// FindTraceSummaries searches traces like FindTraceIDs and returns their summaries, in the same
+// order, without reading their spans. Traces without a summary, written before the traces table
+// existed, are left out.
+func (r *TraceReader) FindTraceSummaries(ctx context.Context, params *spanstore.TraceQueryParameters) ([]TraceSummary, error) {
+	ctx, span := r.tracer.Start(ctx, "FindTraceSummaries")
+	defer span.End()
+
+	if r.tracesTable == "" {
+		return nil, errNoTracesTable
+	}
+
+	traceIDs, err := r.FindTraceIDs(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+
+	summaries := make([]TraceSummary, 0, len(traceIDs))
+	if len(traceIDs) == 0 {
+		return summaries, nil
+	}
+
+	values := make([]interface{}, len(traceIDs))
+	for i, traceID := range traceIDs {
+		values[i] = traceID.String()
+	}
+
+	query := fmt.Sprintf(
+		"SELECT traceID, startTime, durationUs, spanCount, rootService, rootOperation, services, errorCount FROM %s WHERE traceID IN (%s)",
+		r.tracesTable, "?"+strings.Repeat(",?", len(values)-1),
+	)
+
+	span.SetAttributes(dbSystem, attribute.String("db.statement", query))
+	span.SetAttributes(attribute.String("db.args", fmt.Sprint(values)))
+
+	rows, err := r.db.QueryContext(ctx, query, values...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	found := make(map[model.TraceID]TraceSummary, len(traceIDs))
+	for rows.Next() {
+		var (
+			traceID                    string
+			durationUs                 int64
+			rootService, rootOperation sql.NullString
+			services                   interface{}
+			errorCount                 sql.NullInt64
+			summary                    TraceSummary
+		)
+		if err := rows.Scan(&traceID, &summary.StartTime, &durationUs, &summary.SpanCount, &rootService, &rootOperation, &services, &errorCount); err != nil {
+			return nil, err
+		}
+		if summary.TraceID, err = model.TraceIDFromString(traceID); err != nil {
+			return nil, err
+		}
+		summary.Duration = time.Duration(durationUs) * time.Microsecond
+		summary.RootService = rootService.String
+		summary.RootOperation = rootOperation.String
+		summary.Services = stringList(services)
+		summary.ErrorCount = errorCount.Int64
+		found[summary.TraceID] = summary
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, traceID := range traceIDs {
+		if summary, ok := found[traceID]; ok {
+			summaries = append(summaries, summary)
+		}
+	}
+
+	return summaries, nil
+}
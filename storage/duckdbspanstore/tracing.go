@@ -0,0 +1,8 @@
+package duckdbspanstore
+
+import "go.opentelemetry.io/otel/attribute"
+
+const tracerName = "github.com/chhetripradeep/jaeger-duckdb/storage/duckdbspanstore"
+
+// dbSystem identifies DuckDB as the database of the spans around SQL statements
+var dbSystem = attribute.String("db.system", "duckdb")
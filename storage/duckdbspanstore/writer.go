@@ -4,6 +4,7 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"sort"
 	"strings"
@@ -14,6 +15,10 @@ import (
 	hclog "github.com/hashicorp/go-hclog"
 	"github.com/jaegertracing/jaeger/model"
 	"github.com/jaegertracing/jaeger/storage/spanstore"
+	"github.com/uber/jaeger-lib/metrics"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type Encoding string
@@ -21,37 +26,71 @@ type Encoding string
 const (
 	// EncodingJSON is used for spans encoded as JSON
 	EncodingJSON Encoding = "json"
+	// EncodingProto is used for spans encoded as Protobuf
+	EncodingProto Encoding = "protobuf"
 )
 
 type SpanWriter struct {
-	logger     hclog.Logger
-	db         *sql.DB
-	indexTable string
-	spansTable string
-	encoding   Encoding
-	delay      time.Duration
-	size       int64
-	spans      chan *model.Span
-	finish     chan bool
-	done       sync.WaitGroup
+	logger      hclog.Logger
+	db          *sql.DB
+	indexTable  string
+	statsTable  string
+	spansTable  string
+	tracesTable string
+	encoding    Encoding
+	delay       time.Duration
+	size        int64
+	synchronous bool
+	metrics     writerMetrics
+	tracer      trace.Tracer
+	spans       chan *model.Span
+	finish      chan bool
+	done        sync.WaitGroup
+	writeMu     sync.Mutex
+	flushErr    error
+}
+
+type writerMetrics struct {
+	SpansReceived metrics.Counter   `metric:"spans_received"`
+	SpansWritten  metrics.Counter   `metric:"spans_written"`
+	SpansFailed   metrics.Counter   `metric:"spans_failed"`
+	SpansSkipped  metrics.Counter   `metric:"spans_skipped"`
+	BatchSize     metrics.Histogram `metric:"batch_size" buckets:"1,10,100,1000,10000"`
+	FlushLatency  metrics.Timer     `metric:"flush_latency"`
+	QueueLength   metrics.Gauge     `metric:"queue_length"`
 }
 
 var _ spanstore.Writer = (*SpanWriter)(nil)
 
-func NewSpanWriter(logger hclog.Logger, db *sql.DB, indexTable, spansTable string, encoding Encoding, delay time.Duration, size int64) *SpanWriter {
+// NewSpanWriter returns a writer that batches spans in the background. A synchronous writer
+// instead writes every span before WriteSpan returns, ignoring delay and size. When statsTable
+// is not empty, the number of index rows per hour, service and operation is kept in it. When
+// tracesTable is not empty, a summary of every trace is kept in it.
+func NewSpanWriter(logger hclog.Logger, db *sql.DB, indexTable, statsTable, spansTable, tracesTable string, encoding Encoding, delay time.Duration, size int64, synchronous bool, metricsFactory metrics.Factory, tracerProvider trace.TracerProvider) *SpanWriter {
 	writer := &SpanWriter{
-		logger:     logger,
-		db:         db,
-		indexTable: indexTable,
-		spansTable: spansTable,
-		encoding:   encoding,
-		delay:      delay,
-		size:       size,
-		spans:      make(chan *model.Span, size),
-		finish:     make(chan bool),
+		logger:      logger,
+		db:          db,
+		indexTable:  indexTable,
+		statsTable:  statsTable,
+		spansTable:  spansTable,
+		tracesTable: tracesTable,
+		encoding:    encoding,
+		delay:       delay,
+		size:        size,
+		synchronous: synchronous,
+		tracer:      tracerProvider.Tracer(tracerName),
+		spans:       make(chan *model.Span, size),
+		finish:      make(chan bool),
 	}
 
-	go writer.backgroundWriter()
+	metrics.MustInit(&writer.metrics, metricsFactory.Namespace(metrics.NSOptions{
+		Name: "writer",
+		Tags: map[string]string{"table": spansTable},
+	}), nil)
+
+	if !synchronous {
+		go writer.backgroundWriter()
+	}
 
 	return writer
 }
@@ -83,19 +122,22 @@ func (w *SpanWriter) backgroundWriter() {
 			}
 		case <-w.finish:
 			finish = true
+			batch = w.drain(batch)
 			flush = len(batch) > 0
 			w.logger.Debug("Finish channel")
 		}
 
 		if flush {
-			if err := w.writeBatch(batch); err != nil {
-				w.logger.Error("Could not write a batch of spans", "error", err)
+			if err := w.flush(context.Background(), batch); err != nil {
+				w.flushErr = err
 			}
 
 			batch = make([]*model.Span, 0, w.size)
 			last = time.Now()
 		}
 
+		w.metrics.QueueLength.Update(int64(len(w.spans)))
+
 		w.done.Done()
 
 		if finish {
@@ -104,25 +146,116 @@ func (w *SpanWriter) backgroundWriter() {
 	}
 }
 
-func (w *SpanWriter) writeBatch(batch []*model.Span) error {
-	w.logger.Debug("Writing spans", "size", len(batch))
-	if err := w.writeModelBatch(batch); err != nil {
+func (w *SpanWriter) flush(ctx context.Context, batch []*model.Span) error {
+	ctx, span := w.tracer.Start(ctx, "flush")
+	defer span.End()
+
+	span.SetAttributes(
+		dbSystem,
+		attribute.String("db.table", w.spansTable),
+		attribute.Int("batch.size", len(batch)),
+	)
+
+	start := time.Now()
+	written, err := w.writeBatch(ctx, batch)
+	w.metrics.FlushLatency.Record(time.Since(start))
+	w.metrics.BatchSize.Record(float64(len(batch)))
+
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		w.metrics.SpansFailed.Inc(int64(len(batch)))
+		w.logger.Error("Could not write a batch of spans", "error", err)
 		return err
 	}
 
+	w.metrics.SpansWritten.Inc(int64(written))
+	w.metrics.SpansSkipped.Inc(int64(len(batch) - written))
+	return nil
+}
+
+// drain appends the spans still queued in the channel to batch
+func (w *SpanWriter) drain(batch []*model.Span) []*model.Span {
+	for {
+		select {
+		case span := <-w.spans:
+			batch = append(batch, span)
+		default:
+			return batch
+		}
+	}
+}
+
+// writeBatch writes the spans of batch that are not stored yet and returns how many there were.
+// The spans and every row derived from them are written in a single transaction, they are
+// either all written or none is.
+//
+// DuckDB 0.6, embedded by the pinned go-duckdb v1.0.8, has no ON CONFLICT clause nor INSERT OR
+// REPLACE. Rows already stored are skipped or updated first, and rows inserted only when none
+// was found.
+func (w *SpanWriter) writeBatch(ctx context.Context, batch []*model.Span) (int, error) {
+	// DuckDB aborts the process when concurrent transactions append the same key to a unique
+	// index, synchronous writes must not commit concurrently
+	w.writeMu.Lock()
+	defer w.writeMu.Unlock()
+
+	tx, err := w.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	batch, err = w.writeModelBatch(ctx, tx, batch)
+	if err != nil {
+		return 0, err
+	}
+
+	w.logger.Debug("Writing spans", "size", len(batch))
+
 	if w.indexTable != "" {
-		if err := w.writeIndexBatch(batch); err != nil {
-			return err
+		if err := w.writeIndexBatch(ctx, tx, batch); err != nil {
+			return 0, err
+		}
+
+		if w.statsTable != "" {
+			if err := w.writeStatsBatch(ctx, tx, batch); err != nil {
+				return 0, err
+			}
 		}
 	}
 
-	return nil
+	if w.tracesTable != "" {
+		if err := w.writeTracesBatch(ctx, tx, batch); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, redactError(err)
+	}
+
+	return len(batch), nil
 }
 
-func (w *SpanWriter) writeModelBatch(batch []*model.Span) error {
-	var err error
+// writeModelBatch inserts the spans of batch that are neither stored already nor repeated earlier
+// in batch, and returns them. Archiving a trace twice or a collector retrying a request would
+// otherwise store every span twice. The unique index on the key rejects any span stored twice.
+func (w *SpanWriter) writeModelBatch(ctx context.Context, tx *sql.Tx, batch []*model.Span) ([]*model.Span, error) {
+	ctx, span := w.tracer.Start(ctx, "writeModelBatch")
+	defer span.End()
+
+	query := fmt.Sprintf(
+		"INSERT INTO %s (timestamp, traceID, spanID, model) SELECT ?, ?, ?, ? WHERE NOT EXISTS (SELECT 1 FROM %s WHERE traceID = ? AND spanID = ?)",
+		w.spansTable, w.spansTable,
+	)
+	span.SetAttributes(dbSystem, attribute.String("db.statement", query))
+
+	written := make([]*model.Span, 0, len(batch))
 	for _, span := range batch {
-		var serialized []byte
+		var (
+			serialized []byte
+			err        error
+		)
 
 		if w.encoding == EncodingJSON {
 			serialized, err = json.Marshal(span)
@@ -130,59 +263,158 @@ func (w *SpanWriter) writeModelBatch(batch []*model.Span) error {
 			serialized, err = proto.Marshal(span)
 		}
 		if err != nil {
-			return err
+			return nil, err
+		}
+
+		traceID, spanID := span.TraceID.String(), span.SpanID.String()
+		result, err := tx.ExecContext(ctx, query, span.StartTime.UTC(), traceID, spanID, string(serialized), traceID, spanID)
+		if err != nil {
+			return nil, redactError(err)
 		}
 
-		_, err = w.db.Exec(
-			fmt.Sprintf(
-				"INSERT INTO %s (timestamp, traceID, model) VALUES ('%s', '%s', '%s')",
-				w.spansTable,
-				span.StartTime.Format(time.RFC3339),
-				span.TraceID.String(),
-				serialized,
-			),
+		inserted, err := result.RowsAffected()
+		if err != nil {
+			return nil, err
+		}
+		if inserted > 0 {
+			written = append(written, span)
+		}
+	}
+	return written, nil
+}
+
+func (w *SpanWriter) writeIndexBatch(ctx context.Context, tx *sql.Tx, batch []*model.Span) error {
+	ctx, span := w.tracer.Start(ctx, "writeIndexBatch")
+	defer span.End()
+
+	span.SetAttributes(
+		dbSystem,
+		attribute.String("db.statement", fmt.Sprintf("INSERT INTO %s (timestamp, traceID, service, operation, durationUs, tags) VALUES (...)", w.indexTable)),
+	)
+
+	for _, span := range batch {
+		tags, tagArgs := listParams(uniqueTagsForSpan(span))
+
+		args := []interface{}{
+			span.StartTime.UTC(),
+			span.TraceID.String(),
+			span.Process.ServiceName,
+			span.OperationName,
+			span.Duration.Microseconds(),
+		}
+		args = append(args, tagArgs...)
+
+		_, err := tx.ExecContext(
+			ctx,
+			fmt.Sprintf("INSERT INTO %s (timestamp, traceID, service, operation, durationUs, tags) VALUES (?, ?, ?, ?, ?, %s)", w.indexTable, tags),
+			args...,
 		)
 		if err != nil {
-			return err
+			return redactError(err)
 		}
 	}
 	return nil
 }
 
-func (w *SpanWriter) writeIndexBatch(batch []*model.Span) error {
-	var err error
+// statsKey identifies a row of the stats table
+type statsKey struct {
+	hour      time.Time
+	service   string
+	operation string
+}
+
+// writeStatsBatch adds the rows of batch to the index row counts, keeping a single row per hour,
+// service and operation. A count is inserted when there was none to update.
+func (w *SpanWriter) writeStatsBatch(ctx context.Context, tx *sql.Tx, batch []*model.Span) error {
+	ctx, span := w.tracer.Start(ctx, "writeStatsBatch")
+	defer span.End()
+
+	update := fmt.Sprintf("UPDATE %s SET rowCount = rowCount + ? WHERE hour = ? AND service = ? AND operation = ?", w.statsTable)
+	insert := fmt.Sprintf("INSERT INTO %s (hour, service, operation, rowCount) VALUES (?, ?, ?, ?)", w.statsTable)
+	span.SetAttributes(dbSystem, attribute.String("db.statement", update))
+
+	counts := make(map[statsKey]int64)
 	for _, span := range batch {
-		_, err = w.db.Exec(
-			fmt.Sprintf(
-				"INSERT INTO %s (timestamp, traceID, service, operation, durationUs, tags) VALUES ('%s', '%s', '%s', '%s', %d, [%s])",
-				w.indexTable,
-				span.StartTime.Format(time.RFC3339),
-				span.TraceID.String(),
-				span.Process.ServiceName,
-				span.OperationName,
-				span.Duration.Microseconds(),
-				strings.Join(uniqueTagsForSpan(span), ","),
-			),
-		)
+		counts[statsKey{
+			hour:      span.StartTime.UTC().Truncate(time.Hour),
+			service:   span.Process.ServiceName,
+			operation: span.OperationName,
+		}]++
+	}
+
+	for key, count := range counts {
+		result, err := tx.ExecContext(ctx, update, count, key.hour, key.service, key.operation)
+		if err != nil {
+			return redactError(err)
+		}
+
+		updated, err := result.RowsAffected()
 		if err != nil {
 			return err
 		}
+		if updated > 0 {
+			continue
+		}
+
+		if _, err := tx.ExecContext(ctx, insert, key.hour, key.service, key.operation, count); err != nil {
+			return redactError(err)
+		}
 	}
 	return nil
 }
 
-func (w *SpanWriter) WriteSpan(_ context.Context, span *model.Span) error {
+func (w *SpanWriter) WriteSpan(ctx context.Context, span *model.Span) error {
+	w.metrics.SpansReceived.Inc(1)
+	if w.synchronous {
+		return w.flush(ctx, []*model.Span{span})
+	}
 	w.spans <- span
 	return nil
 }
 
+// QueueLength returns the number of spans waiting to be batched
+func (w *SpanWriter) QueueLength() int {
+	return len(w.spans)
+}
+
+// Close flushes pending spans and stops the background writer. It returns the error of the last
+// batch that could not be written, if any. The database is left open.
 func (w *SpanWriter) Close() error {
+	if w.synchronous {
+		return nil
+	}
 	w.finish <- true
 	w.done.Wait()
-	w.db.Close()
+	if w.flushErr != nil {
+		return fmt.Errorf("could not write every batch of spans: %w", w.flushErr)
+	}
 	return nil
 }
 
+// redactError keeps the first line of a DuckDB error. The following lines quote the statement
+// around the failing position, which would leak span payloads into the logs.
+func redactError(err error) error {
+	message, _, found := strings.Cut(err.Error(), "\n")
+	if !found {
+		return err
+	}
+	return errors.New(message)
+}
+
+// listParams returns a list literal of query parameters for values and the arguments to bind to
+// them. go-duckdb cannot bind a slice to a single parameter.
+func listParams(values []string) (string, []interface{}) {
+	if len(values) == 0 {
+		return "[]", nil
+	}
+
+	args := make([]interface{}, len(values))
+	for i, value := range values {
+		args[i] = value
+	}
+	return "[?" + strings.Repeat(", ?", len(values)-1) + "]", args
+}
+
 func uniqueTagsForSpan(span *model.Span) []string {
 	uniqueTags := make(map[string]struct{}, len(span.Tags)+len(span.Process.Tags))
 
@@ -212,5 +444,5 @@ func uniqueTagsForSpan(span *model.Span) []string {
 }
 
 func tagString(kv *model.KeyValue) string {
-	return fmt.Sprintf("'%s=%s'", kv.Key, kv.AsString())
+	return kv.Key + "=" + kv.AsString()
 }
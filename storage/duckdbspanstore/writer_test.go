@@ -0,0 +1,327 @@
+package duckdbspanstore
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	hclog "github.com/hashicorp/go-hclog"
+	"github.com/jaegertracing/jaeger/model"
+	"github.com/jaegertracing/jaeger/storage/spanstore"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/jaeger-lib/metrics"
+	"github.com/uber/jaeger-lib/metrics/metricstest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestRedactError(t *testing.T) {
+	err := errors.New("Parser Error: syntax error at or near \"'x'\"\nLINE 1: ... VALUES ('{\"secret\":\"payload\"}' 'x')\n        ^")
+	assert.EqualError(t, redactError(err), "Parser Error: syntax error at or near \"'x'\"")
+
+	err = errors.New("Conversion Error: timestamp field value out of range")
+	assert.Equal(t, err, redactError(err))
+}
+
+func TestSpanWriter_transaction(t *testing.T) {
+	db := newTestDB(t,
+		"CREATE TABLE jaeger_index (timestamp Timestamp, traceID String, service String, operation String, durationUs UInt64, tags String[])",
+		"CREATE TABLE jaeger_spans (timestamp Timestamp, traceID String, spanID String, model String)",
+		"CREATE UNIQUE INDEX jaeger_spans_span_key ON jaeger_spans (traceID, spanID)",
+	)
+	span := &model.Span{
+		TraceID:       model.NewTraceID(0, 1),
+		SpanID:        model.NewSpanID(1),
+		OperationName: "GET /",
+		StartTime:     time.Date(2022, 1, 1, 10, 0, 0, 0, time.UTC),
+		Process:       model.NewProcess("frontend", nil),
+	}
+	count := func(table string) int64 {
+		var count int64
+		require.NoError(t, db.QueryRow("SELECT count(*) FROM "+table).Scan(&count))
+		return count
+	}
+
+	// The traces table is missing, the spans and index rows written before it are rolled back
+	failing := NewSpanWriter(hclog.NewNullLogger(), db, "jaeger_index", "", "jaeger_spans", "jaeger_missing_traces", EncodingJSON, time.Hour, 10, true, metrics.NullFactory, trace.NewNoopTracerProvider())
+	require.Error(t, failing.WriteSpan(context.Background(), span))
+	assert.Zero(t, count("jaeger_spans"))
+	assert.Zero(t, count("jaeger_index"))
+
+	// A span repeated in a batch or written again is stored once
+	writer := NewSpanWriter(hclog.NewNullLogger(), db, "jaeger_index", "", "jaeger_spans", "", EncodingJSON, time.Hour, 10, true, metrics.NullFactory, trace.NewNoopTracerProvider())
+	written, err := writer.writeBatch(context.Background(), []*model.Span{span, span})
+	require.NoError(t, err)
+	assert.Equal(t, 1, written)
+	written, err = writer.writeBatch(context.Background(), []*model.Span{span})
+	require.NoError(t, err)
+	assert.Zero(t, written)
+	assert.Equal(t, int64(1), count("jaeger_spans"))
+	assert.Equal(t, int64(1), count("jaeger_index"))
+}
+
+func TestSpanWriter_tags(t *testing.T) {
+	db := newTestDB(t,
+		"CREATE TABLE jaeger_index (timestamp Timestamp, traceID String, service String, operation String, durationUs UInt64, tags String[])",
+		"CREATE TABLE jaeger_spans (timestamp Timestamp, traceID String, spanID String, model String)",
+	)
+	writer := NewSpanWriter(hclog.NewNullLogger(), db, "jaeger_index", "", "jaeger_spans", "", EncodingJSON, time.Hour, 10, true, metrics.NullFactory, trace.NewNoopTracerProvider())
+	defer writer.Close()
+
+	// Tag values are bound, quotes and list syntax in them are stored as is
+	statement := "SELECT * FROM users WHERE name = 'O''Brien' AND tags = ['a', 'b']"
+	start := time.Date(2022, 1, 1, 10, 0, 0, 0, time.UTC)
+	for i, tags := range [][]model.KeyValue{
+		{model.String("db.statement", statement), model.String("it's", "a key")},
+		nil,
+	} {
+		require.NoError(t, writer.WriteSpan(context.Background(), &model.Span{
+			TraceID:       model.NewTraceID(0, uint64(i+1)),
+			SpanID:        model.NewSpanID(1),
+			OperationName: "SELECT",
+			StartTime:     start,
+			Process:       model.NewProcess("backend", nil),
+			Tags:          tags,
+		}))
+	}
+
+	var stored interface{}
+	require.NoError(t, db.QueryRow("SELECT tags FROM jaeger_index WHERE traceID = ?", model.NewTraceID(0, 1).String()).Scan(&stored))
+	assert.Equal(t, []string{"db.statement=" + statement, "it's=a key"}, stringList(stored))
+	require.NoError(t, db.QueryRow("SELECT tags FROM jaeger_index WHERE traceID = ?", model.NewTraceID(0, 2).String()).Scan(&stored))
+	assert.Empty(t, stringList(stored))
+
+	reader := NewTraceReader(db, "jaeger_index", "", "", "jaeger_spans", "", "", false, trace.NewNoopTracerProvider())
+	found, err := reader.FindTraceIDs(context.Background(), &spanstore.TraceQueryParameters{
+		ServiceName:  "backend",
+		Tags:         map[string]string{"db.statement": statement},
+		StartTimeMin: start.Add(-time.Minute),
+		StartTimeMax: start.Add(time.Minute),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []model.TraceID{model.NewTraceID(0, 1)}, found)
+}
+
+func TestSpanWriter_Close(t *testing.T) {
+	db := newTestDB(t, "CREATE TABLE jaeger_spans (timestamp Timestamp, traceID String, spanID String, model String)")
+	span := &model.Span{
+		TraceID:   model.NewTraceID(0, 1),
+		SpanID:    model.NewSpanID(1),
+		StartTime: time.Date(2022, 1, 1, 10, 0, 0, 0, time.UTC),
+		Process:   model.NewProcess("frontend", nil),
+	}
+
+	writer := NewSpanWriter(hclog.NewNullLogger(), db, "", "", "jaeger_spans", "", EncodingJSON, time.Hour, 10, false, metrics.NullFactory, trace.NewNoopTracerProvider())
+	require.NoError(t, writer.WriteSpan(context.Background(), span))
+	assert.NoError(t, writer.Close())
+
+	// WriteSpan only queues the span, the failed batch is reported on close
+	writer = NewSpanWriter(hclog.NewNullLogger(), db, "", "", "jaeger_missing_spans", "", EncodingJSON, time.Hour, 10, false, metrics.NullFactory, trace.NewNoopTracerProvider())
+	require.NoError(t, writer.WriteSpan(context.Background(), span))
+	assert.ErrorContains(t, writer.Close(), "jaeger_missing_spans")
+}
+
+func TestSpanWriter_stats(t *testing.T) {
+	db := newTestDB(t,
+		"CREATE TABLE jaeger_index (timestamp Timestamp, traceID String, service String, operation String, durationUs UInt64, tags String[])",
+		"CREATE TABLE jaeger_index_stats (hour Timestamp, service String, operation String, rowCount UInt64)",
+		"CREATE TABLE jaeger_spans (timestamp Timestamp, traceID String, spanID String, model String)",
+	)
+	writer := NewSpanWriter(hclog.NewNullLogger(), db, "jaeger_index", "jaeger_index_stats", "jaeger_spans", "", EncodingJSON, time.Hour, 10, true, metrics.NullFactory, trace.NewNoopTracerProvider())
+	defer writer.Close()
+
+	hour := time.Date(2022, 1, 1, 10, 0, 0, 0, time.UTC)
+	for i, span := range []*model.Span{
+		{StartTime: hour.Add(time.Minute), OperationName: "GET /", Process: model.NewProcess("frontend", nil)},
+		{StartTime: hour.Add(59 * time.Minute), OperationName: "GET /", Process: model.NewProcess("frontend", nil)},
+		{StartTime: hour.Add(time.Hour), OperationName: "GET /", Process: model.NewProcess("frontend", nil)},
+	} {
+		span.TraceID = model.NewTraceID(0, uint64(i+1))
+		span.SpanID = model.NewSpanID(uint64(i + 1))
+		require.NoError(t, writer.WriteSpan(context.Background(), span))
+	}
+
+	// Every batch adds to the row of its hour, service and operation
+	rows, err := db.Query("SELECT hour, rowCount::BIGINT FROM jaeger_index_stats WHERE service = 'frontend' AND operation = 'GET /' ORDER BY hour")
+	require.NoError(t, err)
+	defer rows.Close()
+
+	counts := map[time.Time]int64{}
+	for rows.Next() {
+		var h time.Time
+		var count int64
+		require.NoError(t, rows.Scan(&h, &count))
+		require.NotContains(t, counts, h)
+		counts[h] = count
+	}
+	require.NoError(t, rows.Err())
+	assert.Equal(t, map[time.Time]int64{hour: 2, hour.Add(time.Hour): 1}, counts)
+}
+
+func TestSpanWriter_traces(t *testing.T) {
+	db := newTestDB(t,
+		"CREATE TABLE jaeger_index (timestamp Timestamp, traceID String, service String, operation String, durationUs UInt64, tags String[])",
+		"CREATE TABLE jaeger_spans (timestamp Timestamp, traceID String, spanID String, model String)",
+		"CREATE TABLE jaeger_traces (traceID String, startTime Timestamp, endTime Timestamp, durationUs UInt64, spanCount UInt64, rootService String, rootOperation String, hasError Boolean, services String[], errorCount UInt64)",
+	)
+	writer := NewSpanWriter(hclog.NewNullLogger(), db, "jaeger_index", "", "jaeger_spans", "jaeger_traces", EncodingJSON, time.Hour, 10, true, metrics.NullFactory, trace.NewNoopTracerProvider())
+	defer writer.Close()
+
+	start := time.Date(2022, 1, 1, 10, 0, 0, 0, time.UTC)
+	traceID := model.NewTraceID(0, 1)
+	for _, span := range []*model.Span{
+		{
+			SpanID:        model.NewSpanID(2),
+			References:    []model.SpanRef{model.NewChildOfRef(traceID, model.NewSpanID(1))},
+			OperationName: "SELECT",
+			StartTime:     start.Add(500 * time.Millisecond),
+			Duration:      2 * time.Second,
+			Process:       model.NewProcess("backend", nil),
+			Tags:          []model.KeyValue{model.Bool("error", true)},
+		},
+		{
+			SpanID:        model.NewSpanID(1),
+			OperationName: "GET /",
+			StartTime:     start,
+			Duration:      time.Second,
+			Process:       model.NewProcess("frontend", nil),
+		},
+	} {
+		span.TraceID = traceID
+		require.NoError(t, writer.WriteSpan(context.Background(), span))
+	}
+
+	var (
+		startTime, endTime         time.Time
+		durationUs, spanCount      int64
+		rootService, rootOperation string
+		hasError                   bool
+		services                   interface{}
+		errorCount                 int64
+	)
+	require.NoError(t, db.QueryRow("SELECT startTime, endTime, durationUs, spanCount, rootService, rootOperation, hasError, services, errorCount FROM jaeger_traces WHERE traceID = ?", traceID.String()).Scan(
+		&startTime, &endTime, &durationUs, &spanCount, &rootService, &rootOperation, &hasError, &services, &errorCount,
+	))
+	assert.Equal(t, start, startTime)
+	assert.Equal(t, start.Add(2500*time.Millisecond), endTime)
+	assert.Equal(t, int64(2_500_000), durationUs)
+	assert.Equal(t, int64(2), spanCount)
+	assert.Equal(t, "frontend", rootService)
+	assert.Equal(t, "GET /", rootOperation)
+	assert.True(t, hasError)
+	assert.Equal(t, []string{"backend", "frontend"}, stringList(services))
+	assert.Equal(t, int64(1), errorCount)
+
+	var summaryRows int64
+	require.NoError(t, db.QueryRow("SELECT count(*) FROM jaeger_traces").Scan(&summaryRows))
+	assert.Equal(t, int64(1), summaryRows, "every batch updates the summary of its trace")
+
+	// A summary backfilled from the index has no services, root or error count yet
+	backfilled := model.NewTraceID(0, 2)
+	_, err := db.Exec("INSERT INTO jaeger_traces (traceID, startTime, endTime, durationUs, spanCount, hasError) VALUES (?, ?, ?, 1000000, 1, true)", backfilled.String(), start, start.Add(time.Second))
+	require.NoError(t, err)
+	require.NoError(t, writer.WriteSpan(context.Background(), &model.Span{
+		TraceID:       backfilled,
+		SpanID:        model.NewSpanID(3),
+		References:    []model.SpanRef{model.NewChildOfRef(backfilled, model.NewSpanID(1))},
+		OperationName: "GET /",
+		StartTime:     start.Add(-time.Second),
+		Duration:      time.Second,
+		Process:       model.NewProcess("frontend", nil),
+	}))
+	require.NoError(t, db.QueryRow("SELECT startTime, durationUs, spanCount, hasError, services, errorCount FROM jaeger_traces WHERE traceID = ?", backfilled.String()).Scan(
+		&startTime, &durationUs, &spanCount, &hasError, &services, &errorCount,
+	))
+	assert.Equal(t, start.Add(-time.Second), startTime)
+	assert.Equal(t, int64(2_000_000), durationUs)
+	assert.Equal(t, int64(2), spanCount)
+	assert.True(t, hasError)
+	assert.Equal(t, []string{"frontend"}, stringList(services))
+	assert.Equal(t, int64(0), errorCount)
+}
+
+func TestSpanWriter_timestamps(t *testing.T) {
+	db := newTestDB(t,
+		"CREATE TABLE jaeger_index (timestamp Timestamp, traceID String, service String, operation String, durationUs UInt64, tags String[])",
+		"CREATE TABLE jaeger_spans (timestamp Timestamp, traceID String, spanID String, model String)",
+		// Written before timestamps were stored with their microseconds
+		"INSERT INTO jaeger_index VALUES ('2022-01-01T09:59:59+00:00', '0000000000000000000000000000000a', 'frontend', 'GET /', 1, [])",
+	)
+	writer := NewSpanWriter(hclog.NewNullLogger(), db, "jaeger_index", "", "jaeger_spans", "", EncodingJSON, time.Hour, 10, true, metrics.NullFactory, trace.NewNoopTracerProvider())
+	defer writer.Close()
+
+	second := time.Date(2022, 1, 1, 10, 0, 0, 0, time.UTC)
+	zone := time.FixedZone("UTC+2", 2*60*60)
+	for i, offset := range []time.Duration{250 * time.Millisecond, 750 * time.Millisecond, 500*time.Millisecond + 1500*time.Microsecond} {
+		require.NoError(t, writer.WriteSpan(context.Background(), &model.Span{
+			TraceID:       model.NewTraceID(0, uint64(i+1)),
+			SpanID:        model.NewSpanID(uint64(i + 1)),
+			OperationName: "GET /",
+			StartTime:     second.Add(offset).In(zone),
+			Process:       model.NewProcess("frontend", nil),
+		}))
+	}
+
+	var stored time.Time
+	require.NoError(t, db.QueryRow("SELECT timestamp FROM jaeger_spans WHERE traceID = ?", model.NewTraceID(0, 3).String()).Scan(&stored))
+	assert.Equal(t, second.Add(501500*time.Microsecond), stored)
+
+	reader := NewTraceReader(db, "jaeger_index", "", "", "jaeger_spans", "", "", false, trace.NewNoopTracerProvider())
+	find := func(min, max time.Time) []model.TraceID {
+		traceIDs, err := reader.FindTraceIDs(context.Background(), &spanstore.TraceQueryParameters{
+			ServiceName:  "frontend",
+			StartTimeMin: min,
+			StartTimeMax: max,
+		})
+		require.NoError(t, err)
+		return traceIDs
+	}
+
+	assert.Equal(t, []model.TraceID{
+		model.NewTraceID(0, 2),
+		model.NewTraceID(0, 3),
+		model.NewTraceID(0, 1),
+		model.NewTraceID(0, 10),
+	}, find(second.Add(-time.Minute), second.Add(time.Minute)))
+	assert.Equal(t, []model.TraceID{model.NewTraceID(0, 3)}, find(second.Add(500*time.Millisecond), second.Add(600*time.Millisecond)))
+}
+
+func TestSpanWriter_metrics(t *testing.T) {
+	db := newTestDB(t,
+		"CREATE TABLE jaeger_spans (timestamp Timestamp, traceID String, spanID String, model String)",
+	)
+	factory := metricstest.NewFactory(0)
+	defer factory.Stop()
+
+	// The batch is only flushed on close, the repeated span is skipped
+	writer := NewSpanWriter(hclog.NewNullLogger(), db, "", "", "jaeger_spans", "", EncodingJSON, time.Hour, 10, false, factory, trace.NewNoopTracerProvider())
+	for _, id := range []uint64{1, 2, 1} {
+		require.NoError(t, writer.WriteSpan(context.Background(), &model.Span{
+			TraceID:   model.NewTraceID(0, 1),
+			SpanID:    model.NewSpanID(id),
+			StartTime: time.Date(2022, 1, 1, 10, 0, 0, 0, time.UTC),
+			Process:   model.NewProcess("frontend", nil),
+		}))
+	}
+	assert.Equal(t, 3, writer.QueueLength())
+	require.NoError(t, writer.Close())
+
+	// Writing to a missing table fails the whole batch
+	failing := NewSpanWriter(hclog.NewNullLogger(), db, "", "", "jaeger_missing", "", EncodingJSON, time.Hour, 10, true, factory, trace.NewNoopTracerProvider())
+	assert.Error(t, failing.WriteSpan(context.Background(), &model.Span{
+		TraceID: model.NewTraceID(0, 2),
+		SpanID:  model.NewSpanID(1),
+		Process: model.NewProcess("frontend", nil),
+	}))
+
+	counters, gauges := factory.Snapshot()
+	assert.Equal(t, int64(3), counters["writer.spans_received|table=jaeger_spans"])
+	assert.Equal(t, int64(2), counters["writer.spans_written|table=jaeger_spans"])
+	assert.Equal(t, int64(1), counters["writer.spans_skipped|table=jaeger_spans"])
+	assert.Equal(t, int64(0), counters["writer.spans_failed|table=jaeger_spans"])
+	assert.Equal(t, int64(0), gauges["writer.queue_length|table=jaeger_spans"])
+	assert.Equal(t, int64(1), counters["writer.spans_received|table=jaeger_missing"])
+	assert.Equal(t, int64(0), counters["writer.spans_written|table=jaeger_missing"])
+	assert.Equal(t, int64(1), counters["writer.spans_failed|table=jaeger_missing"])
+}
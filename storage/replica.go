@@ -0,0 +1,268 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	hclog "github.com/hashicorp/go-hclog"
+	"github.com/jaegertracing/jaeger/model"
+	"github.com/jaegertracing/jaeger/storage/spanstore"
+	"github.com/uber/jaeger-lib/metrics"
+
+	"github.com/chhetripradeep/jaeger-duckdb/storage/duckdbdependencystore"
+	"github.com/chhetripradeep/jaeger-duckdb/storage/duckdbspanstore"
+)
+
+// replicaRetryInterval is the longest wait between attempts to open the data file for the first time
+const replicaRetryInterval = 5 * time.Second
+
+// replica holds a read-only connection to the data file. DuckDB only sees the data that was
+// checkpointed when the file was opened, so the connection is replaced on every reopen.
+type replica struct {
+	logger    hclog.Logger
+	open      func() (*sql.DB, error)
+	newReader func(db *sql.DB) spanstore.Reader
+	mu        sync.RWMutex
+	db        *sql.DB
+	reader    spanstore.Reader
+	openErr   error
+}
+
+// newReplica opens the data file. DuckDB locks the file of a process writing to it, even against
+// read-only opens from other processes, so a failed first open is retried in the background.
+func newReplica(logger hclog.Logger, open func() (*sql.DB, error), newReader func(db *sql.DB) spanstore.Reader) *replica {
+	r := &replica{
+		logger:    logger,
+		open:      open,
+		newReader: newReader,
+	}
+
+	if err := r.reopen(); err != nil {
+		logger.Warn("Could not open the read-only database, retrying", "error", err)
+	}
+
+	return r
+}
+
+// reopen replaces the connection once the queries running on the previous one are done.
+// The previous connection is kept if the file cannot be opened.
+func (r *replica) reopen() error {
+	db, err := r.open()
+	if err != nil {
+		r.mu.Lock()
+		if r.db == nil {
+			r.openErr = err
+		}
+		r.mu.Unlock()
+		return err
+	}
+
+	reader := r.newReader(db)
+
+	r.mu.Lock()
+	previous := r.db
+	r.db, r.reader, r.openErr = db, reader, nil
+	r.mu.Unlock()
+
+	if previous != nil {
+		return previous.Close()
+	}
+	return nil
+}
+
+func (r *replica) backgroundReopen(interval time.Duration, finish <-chan bool, done *sync.WaitGroup) {
+	defer done.Done()
+
+	for {
+		wait := interval
+		if !r.isOpen() && wait > replicaRetryInterval {
+			wait = replicaRetryInterval
+		}
+
+		select {
+		case <-time.After(wait):
+			if err := r.reopen(); err != nil {
+				r.logger.Warn("Could not reopen the read-only database, serving the previous snapshot", "error", err)
+			}
+		case <-finish:
+			return
+		}
+	}
+}
+
+func (r *replica) isOpen() bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.db != nil
+}
+
+// withDB runs fn with the current connection, which is not closed before fn returns.
+// It fails with the open error while the data file could never be opened.
+func (r *replica) withDB(fn func(db *sql.DB) error) error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.db == nil {
+		return r.openErr
+	}
+	return fn(r.db)
+}
+
+func (r *replica) close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.db == nil {
+		return nil
+	}
+	return r.db.Close()
+}
+
+// replicaReader queries the current connection of a replica
+type replicaReader struct {
+	replica *replica
+}
+
+var _ spanstore.Reader = (*replicaReader)(nil)
+
+// current returns the reader of the current connection, release must be called once it is no longer used.
+// It fails with the open error while the data file could never be opened.
+func (r *replicaReader) current() (reader spanstore.Reader, release func(), err error) {
+	r.replica.mu.RLock()
+	if r.replica.reader == nil {
+		err = r.replica.openErr
+		r.replica.mu.RUnlock()
+		return nil, nil, err
+	}
+	return r.replica.reader, r.replica.mu.RUnlock, nil
+}
+
+func (r *replicaReader) GetTrace(ctx context.Context, traceID model.TraceID) (*model.Trace, error) {
+	reader, release, err := r.current()
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	return reader.GetTrace(ctx, traceID)
+}
+
+func (r *replicaReader) GetServices(ctx context.Context) ([]string, error) {
+	reader, release, err := r.current()
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	return reader.GetServices(ctx)
+}
+
+func (r *replicaReader) GetOperations(ctx context.Context, query spanstore.OperationQueryParameters) ([]spanstore.Operation, error) {
+	reader, release, err := r.current()
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	return reader.GetOperations(ctx, query)
+}
+
+func (r *replicaReader) FindTraces(ctx context.Context, query *spanstore.TraceQueryParameters) ([]*model.Trace, error) {
+	reader, release, err := r.current()
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	return reader.FindTraces(ctx, query)
+}
+
+func (r *replicaReader) FindTraceIDs(ctx context.Context, query *spanstore.TraceQueryParameters) ([]model.TraceID, error) {
+	reader, release, err := r.current()
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	return reader.FindTraceIDs(ctx, query)
+}
+
+func (r *replicaReader) FindTraceSummaries(ctx context.Context, query *spanstore.TraceQueryParameters) ([]duckdbspanstore.TraceSummary, error) {
+	reader, release, err := r.current()
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	summaries, ok := reader.(traceSummaryReader)
+	if !ok {
+		return nil, errNoSummaries
+	}
+	return summaries.FindTraceSummaries(ctx, query)
+}
+
+// newReadOnlyStore returns a Store that serves data files written by another process. DuckDB lets
+// a single process open a file while it is opened for writing, the files are only read while
+// the writing process is stopped or from copies of them.
+func newReadOnlyStore(logger hclog.Logger, cfg Configuration, metricsFactory metrics.Factory) (*Store, error) {
+	tracing, _, err := newTracerProvider(logger, cfg, nil)
+	if err != nil {
+		return nil, err
+	}
+	tracerProvider := tracerProviderOrNoop(tracing)
+
+	var parquetFilesTable string
+	if cfg.ParquetDir != "" {
+		parquetFilesTable = cfg.ParquetFilesTable
+	}
+
+	open := func(path string, parquet bool) func() (*sql.DB, error) {
+		return func() (*sql.DB, error) {
+			dsn, err := dsnWithOption(path, "access_mode", "read_only")
+			if err != nil {
+				return nil, err
+			}
+			db, err := connector(dsn, cfg)
+			if err != nil {
+				if strings.Contains(err.Error(), "Could not set lock on file") {
+					return nil, fmt.Errorf("%w: %s", errDataFileLocked, path)
+				}
+				return nil, fmt.Errorf("could not connect to database: %q", err)
+			}
+			if parquet {
+				if err := loadExtension(db, "parquet"); err != nil {
+					_ = db.Close()
+					return nil, err
+				}
+			}
+			return db, nil
+		}
+	}
+
+	primary := newReplica(logger.Named("replica"), open(cfg.DataFile, cfg.ParquetDir != ""), func(db *sql.DB) spanstore.Reader {
+		return duckdbspanstore.NewTraceReader(db, cfg.IndexTable, cfg.IndexStatsTable, cfg.OperationsTable, cfg.SpansTable, cfg.TracesTable, parquetFilesTable, cfg.SearchTraceDuration, tracerProvider)
+	})
+	archive := newReplica(logger.Named("replica").With("archive", true), open(cfg.archiveDataFile(), false), func(db *sql.DB) spanstore.Reader {
+		return duckdbspanstore.NewTraceReader(db, cfg.ArchiveIndexTable, "", cfg.ArchiveOperationsTable, cfg.SpansArchiveTable, "", "", false, tracerProvider)
+	})
+
+	readerLogger := logger.Named("reader")
+
+	store := &Store{
+		logger:              logger,
+		replica:             primary,
+		archiveReplica:      archive,
+		writer:              readOnlyWriter{},
+		reader:              decorateReader(readerLogger, &replicaReader{replica: primary}, cfg, metricsFactory),
+		summaries:           &replicaReader{replica: primary},
+		archiveWriter:       readOnlyWriter{},
+		archiveReader:       decorateReader(readerLogger.With("archive", true), &replicaReader{replica: archive}, cfg, archiveMetricsFactory(metricsFactory)),
+		dependencies:        duckdbdependencystore.NewDependencyStore(metricsFactory),
+		tracing:             tracing,
+		schemaTables:        []string{cfg.IndexTable, cfg.IndexStatsTable, cfg.SpansTable, cfg.TracesTable},
+		archiveSchemaTables: archiveSchemaTables(cfg),
+		finish:              make(chan bool),
+	}
+
+	store.done.Add(2)
+	go primary.backgroundReopen(cfg.ReadOnlyReopenInterval, store.finish, &store.done)
+	go archive.backgroundReopen(cfg.ReadOnlyReopenInterval, store.finish, &store.done)
+
+	return store, nil
+}
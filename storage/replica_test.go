@@ -0,0 +1,191 @@
+package storage
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/jaegertracing/jaeger/model"
+	"github.com/jaegertracing/jaeger/storage/spanstore"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/jaeger-lib/metrics"
+)
+
+func writeTestSpans(t *testing.T, cfg Configuration, services ...string) {
+	t.Helper()
+
+	store, err := NewStore(hclog.NewNullLogger(), cfg, metrics.NullFactory)
+	require.NoError(t, err)
+
+	for i, service := range services {
+		err := store.SpanWriter().WriteSpan(context.Background(), &model.Span{
+			TraceID:       model.NewTraceID(0, uint64(i+1)),
+			SpanID:        model.NewSpanID(uint64(i + 1)),
+			OperationName: "GET /",
+			StartTime:     time.Now(),
+			Duration:      time.Millisecond,
+			Process:       model.NewProcess(service, nil),
+		})
+		require.NoError(t, err)
+	}
+
+	require.NoError(t, store.Close())
+}
+
+func TestReadOnlyStore(t *testing.T) {
+	cfg := Configuration{
+		DataFile:          filepath.Join(t.TempDir(), "jaeger.db"),
+		InitSQLScriptsDir: "../schema",
+	}
+	writeTestSpans(t, cfg, "frontend")
+
+	readOnlyCfg := cfg
+	readOnlyCfg.ReadOnly = true
+	readOnlyCfg.ReadOnlyReopenInterval = time.Hour
+	store, err := NewStore(hclog.NewNullLogger(), readOnlyCfg, metrics.NullFactory)
+	require.NoError(t, err)
+	defer store.Close()
+
+	ctx := context.Background()
+	assert.NoError(t, store.Ping(ctx))
+	assert.NoError(t, store.Ready(ctx))
+
+	services, err := store.SpanReader().GetServices(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"frontend"}, services)
+
+	span := &model.Span{Process: model.NewProcess("frontend", nil)}
+	assert.ErrorIs(t, store.SpanWriter().WriteSpan(ctx, span), errReadOnly)
+	assert.ErrorIs(t, store.ArchiveSpanWriter().WriteSpan(ctx, span), errReadOnly)
+
+	_, err = store.ExportParquet(ctx, time.Unix(0, 0), time.Now())
+	assert.ErrorIs(t, err, errReadOnly)
+	_, err = store.PurgeArchive(ctx, time.Now())
+	assert.ErrorIs(t, err, errReadOnly)
+
+	writeTestSpans(t, cfg, "frontend", "backend")
+
+	services, err = store.SpanReader().GetServices(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"frontend"}, services, "data written after opening is not visible before a reopen")
+
+	require.NoError(t, store.replica.reopen())
+
+	services, err = store.SpanReader().GetServices(ctx)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"frontend", "backend"}, services)
+
+	_, err = store.SpanReader().FindTraceIDs(ctx, &spanstore.TraceQueryParameters{
+		ServiceName:  "backend",
+		StartTimeMin: time.Now().Add(-time.Hour),
+		StartTimeMax: time.Now(),
+		NumTraces:    10,
+	})
+	assert.NoError(t, err)
+}
+
+func TestDSNWithOption(t *testing.T) {
+	for dsn, expected := range map[string]string{
+		"/data/jaeger.db":                        "/data/jaeger.db?access_mode=read_only",
+		"/data/jaeger.db?threads=4":              "/data/jaeger.db?access_mode=read_only&threads=4",
+		"/data/jaeger.db?access_mode=read_write": "/data/jaeger.db?access_mode=read_only",
+		"/data/my traces/jaeger.db":              "/data/my%20traces/jaeger.db?access_mode=read_only",
+	} {
+		actual, err := dsnWithOption(dsn, "access_mode", "read_only")
+		require.NoError(t, err)
+		assert.Equal(t, expected, actual, dsn)
+	}
+}
+
+func TestReadOnlyStore_dataFileOptions(t *testing.T) {
+	cfg := Configuration{
+		DataFile:          filepath.Join(t.TempDir(), "my traces", "jaeger.db") + "?threads=2",
+		InitSQLScriptsDir: "../schema",
+	}
+	require.NoError(t, os.MkdirAll(filepath.Dir(cfg.DataFile), 0o750))
+	writeTestSpans(t, cfg, "frontend")
+
+	cfg.ReadOnly = true
+	cfg.ReadOnlyReopenInterval = time.Hour
+	store, err := NewStore(hclog.NewNullLogger(), cfg, metrics.NullFactory)
+	require.NoError(t, err)
+	defer store.Close()
+
+	services, err := store.SpanReader().GetServices(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"frontend"}, services)
+
+	var threads string
+	require.NoError(t, store.replica.db.QueryRow("SELECT current_setting('threads')").Scan(&threads))
+	assert.Equal(t, "2", threads)
+}
+
+// writerProcessEnv names the data file a helper process keeps open for writing
+const writerProcessEnv = "JAEGER_DUCKDB_TEST_WRITER_DATA_FILE"
+
+// TestWriterProcess is not a test, it runs as the helper process of TestReadOnlyStore_writerProcess.
+// It opens the data file for writing, prints a line once it is open and holds it until stdin is closed.
+func TestWriterProcess(t *testing.T) {
+	dataFile := os.Getenv(writerProcessEnv)
+	if dataFile == "" {
+		t.Skip("only runs as a helper process")
+	}
+
+	store, err := NewStore(hclog.NewNullLogger(), Configuration{DataFile: dataFile, InitSQLScriptsDir: "../schema"}, metrics.NullFactory)
+	require.NoError(t, err)
+	defer store.Close()
+
+	fmt.Println("open")
+	_, _ = io.Copy(io.Discard, os.Stdin)
+}
+
+func TestReadOnlyStore_writerProcess(t *testing.T) {
+	cfg := Configuration{
+		DataFile:          filepath.Join(t.TempDir(), "jaeger.db"),
+		InitSQLScriptsDir: "../schema",
+	}
+	writeTestSpans(t, cfg, "frontend")
+
+	// DuckDB locks the file of a writing process, other processes cannot open it even read-only
+	writer := exec.Command(os.Args[0], "-test.run=^TestWriterProcess$")
+	writer.Env = append(os.Environ(), writerProcessEnv+"="+cfg.DataFile)
+	stdin, err := writer.StdinPipe()
+	require.NoError(t, err)
+	stdout, err := writer.StdoutPipe()
+	require.NoError(t, err)
+	require.NoError(t, writer.Start())
+	defer func() { _ = writer.Process.Kill() }()
+
+	line, err := bufio.NewReader(stdout).ReadString('\n')
+	require.NoError(t, err)
+	require.Equal(t, "open\n", line)
+
+	cfg.ReadOnly = true
+	cfg.ReadOnlyReopenInterval = 100 * time.Millisecond
+	store, err := NewStore(hclog.NewNullLogger(), cfg, metrics.NullFactory)
+	require.NoError(t, err, "the first open is retried in the background")
+	defer store.Close()
+
+	ctx := context.Background()
+	err = store.Ping(ctx)
+	assert.ErrorIs(t, err, errDataFileLocked)
+	_, err = store.SpanReader().GetServices(ctx)
+	assert.ErrorIs(t, err, errDataFileLocked)
+
+	// The replica opens the file once the writer is stopped
+	require.NoError(t, stdin.Close())
+	require.NoError(t, writer.Wait())
+
+	require.Eventually(t, func() bool { return store.Ping(ctx) == nil }, 5*time.Second, 50*time.Millisecond)
+	services, err := store.SpanReader().GetServices(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"frontend"}, services)
+}
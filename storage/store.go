@@ -1,66 +1,325 @@
 package storage
 
 import (
+	"context"
 	"database/sql"
+	"database/sql/driver"
+	"errors"
 	"fmt"
 	"io"
+	"net/url"
 	"os"
 	"path/filepath"
 	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	hclog "github.com/hashicorp/go-hclog"
+	"github.com/jaegertracing/jaeger/model"
 	"github.com/jaegertracing/jaeger/plugin/storage/grpc/shared"
 	"github.com/jaegertracing/jaeger/storage/dependencystore"
 	"github.com/jaegertracing/jaeger/storage/spanstore"
-	_ "github.com/marcboeker/go-duckdb"
+	duckdb "github.com/marcboeker/go-duckdb"
+	"github.com/uber/jaeger-lib/metrics"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
 
 	"github.com/chhetripradeep/jaeger-duckdb/storage/duckdbdependencystore"
 	"github.com/chhetripradeep/jaeger-duckdb/storage/duckdbspanstore"
 )
 
 type Store struct {
-	db            *sql.DB
-	writer        spanstore.Writer
-	reader        spanstore.Reader
-	archiveWriter spanstore.Writer
-	archiveReader spanstore.Reader
+	logger              hclog.Logger
+	db                  *sql.DB
+	archiveDB           *sql.DB
+	replica             *replica
+	archiveReplica      *replica
+	writer              spanstore.Writer
+	reader              spanstore.Reader
+	archiveWriter       spanstore.Writer
+	archiveReader       spanstore.Reader
+	summaries           traceSummaryReader
+	dependencies        dependencystore.Reader
+	exporter            *duckdbspanstore.ParquetExporter
+	tracing             *sdktrace.TracerProvider
+	tracingWriter       *duckdbspanstore.SpanWriter
+	schemaTables        []string
+	archiveSchemaTables []string
+	maxQueue            int
+	finish              chan bool
+	done                sync.WaitGroup
 }
 
 var (
-	_ shared.StoragePlugin        = (*Store)(nil)
-	_ shared.ArchiveStoragePlugin = (*Store)(nil)
-	_ io.Closer                   = (*Store)(nil)
+	_ shared.StoragePlugin             = (*Store)(nil)
+	_ shared.ArchiveStoragePlugin      = (*Store)(nil)
+	_ shared.StreamingSpanWriterPlugin = (*Store)(nil)
+	_ io.Closer                        = (*Store)(nil)
 )
 
-func NewStore(logger hclog.Logger, cfg Configuration) (*Store, error) {
-	cfg.setDefaults()
+var (
+	errReadOnly    = errors.New("storage is read-only")
+	errBacklog     = errors.New("span writer is backlogged")
+	errNoSummaries = errors.New("storage has no trace summaries")
+	// errDataFileLocked is returned when opening a data file that another process has opened for writing
+	errDataFileLocked = errors.New("data file is locked by another process, stop the process writing to it")
+)
+
+// traceSummaryReader is implemented by the readers that keep a summary of every trace
+type traceSummaryReader interface {
+	FindTraceSummaries(ctx context.Context, query *spanstore.TraceQueryParameters) ([]duckdbspanstore.TraceSummary, error)
+}
+
+// queueLengther is implemented by writers that buffer spans before writing them
+type queueLengther interface {
+	QueueLength() int
+}
+
+func NewStore(logger hclog.Logger, cfg Configuration, metricsFactory metrics.Factory) (*Store, error) {
+	cfg.SetDefaults()
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	if cfg.ParquetSourceGlob != "" {
+		return newParquetSourceStore(logger, cfg, metricsFactory)
+	}
+
+	if cfg.ReadOnly {
+		return newReadOnlyStore(logger, cfg, metricsFactory)
+	}
 
-	db, err := connector(cfg)
+	db, err := connector(cfg.DataFile, cfg)
 	if err != nil {
 		return nil, fmt.Errorf("could not connect to database: %q", err)
 	}
 
-	if err := runInitScripts(logger, db, cfg); err != nil {
+	if err := runInitScripts(logger.Named("migrations"), db, cfg); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+
+	var parquetFilesTable string
+	if cfg.ParquetDir != "" {
+		if err := loadExtension(db, "parquet"); err != nil {
+			_ = db.Close()
+			return nil, err
+		}
+		parquetFilesTable = cfg.ParquetFilesTable
+	}
+
+	archiveDB := db
+	if cfg.ArchiveDataFile != "" {
+		archiveDB, err = connector(cfg.ArchiveDataFile, cfg)
+		if err != nil {
+			_ = db.Close()
+			return nil, fmt.Errorf("could not connect to archive database: %q", err)
+		}
+
+		if err := runInitScripts(logger.Named("migrations").With("archive", true), archiveDB, cfg); err != nil {
+			_ = archiveDB.Close()
+			_ = db.Close()
+			return nil, err
+		}
+	}
+
+	tracing, tracingWriter, err := newTracerProvider(logger, cfg, db)
+	if err != nil {
+		if archiveDB != db {
+			_ = archiveDB.Close()
+		}
+		_ = db.Close()
+		return nil, err
+	}
+	tracerProvider := tracerProviderOrNoop(tracing)
+
+	writerLogger := logger.Named("writer")
+	readerLogger := logger.Named("reader")
+	reader := duckdbspanstore.NewTraceReader(db, cfg.IndexTable, cfg.IndexStatsTable, cfg.OperationsTable, cfg.SpansTable, cfg.TracesTable, parquetFilesTable, cfg.SearchTraceDuration, tracerProvider)
+
+	store := &Store{
+		logger:              logger,
+		db:                  db,
+		writer:              duckdbspanstore.NewSpanWriter(writerLogger, db, cfg.IndexTable, cfg.IndexStatsTable, cfg.SpansTable, cfg.TracesTable, duckdbspanstore.Encoding(cfg.Encoding), cfg.BatchFlushInterval, cfg.BatchWriteSize, cfg.SyncWrites, metricsFactory, tracerProvider),
+		reader:              decorateReader(readerLogger, reader, cfg, metricsFactory),
+		archiveWriter:       duckdbspanstore.NewSpanWriter(writerLogger.With("archive", true), archiveDB, cfg.ArchiveIndexTable, "", cfg.SpansArchiveTable, "", duckdbspanstore.Encoding(cfg.Encoding), cfg.ArchiveBatchFlushInterval, cfg.ArchiveBatchWriteSize, cfg.ArchiveSyncWrites, archiveMetricsFactory(metricsFactory), tracerProvider),
+		archiveReader:       decorateReader(readerLogger.With("archive", true), duckdbspanstore.NewTraceReader(archiveDB, cfg.ArchiveIndexTable, "", cfg.ArchiveOperationsTable, cfg.SpansArchiveTable, "", "", false, tracerProvider), cfg, archiveMetricsFactory(metricsFactory)),
+		summaries:           reader,
+		dependencies:        duckdbdependencystore.NewDependencyStore(metricsFactory),
+		exporter:            duckdbspanstore.NewParquetExporter(logger.Named("parquet"), db, cfg.IndexTable, cfg.SpansTable, cfg.ParquetFilesTable, cfg.ParquetDir),
+		tracing:             tracing,
+		tracingWriter:       tracingWriter,
+		schemaTables:        []string{cfg.IndexTable, cfg.IndexStatsTable, cfg.SpansTable, cfg.TracesTable},
+		archiveSchemaTables: archiveSchemaTables(cfg),
+		maxQueue:            cfg.ReadyMaxQueueLength,
+		finish:              make(chan bool),
+	}
+	if archiveDB != db {
+		store.archiveDB = archiveDB
+	}
+
+	if cfg.ParquetDir != "" && cfg.ParquetExportInterval > 0 {
+		store.done.Add(1)
+		go store.backgroundExporter(cfg.ParquetExportInterval, cfg.ParquetExportAge)
+	}
+
+	if cfg.ArchiveRetention > 0 {
+		store.done.Add(1)
+		go store.backgroundArchivePurge(cfg.ArchiveRetention)
+	}
+
+	return store, nil
+}
+
+// newParquetSourceStore returns a read-only Store serving spans from an existing Parquet dataset
+func newParquetSourceStore(logger hclog.Logger, cfg Configuration, metricsFactory metrics.Factory) (*Store, error) {
+	db, err := connector("", cfg)
+	if err != nil {
+		return nil, fmt.Errorf("could not connect to database: %q", err)
+	}
+
+	extensions := []string{"parquet"}
+	if isRemotePath(cfg.ParquetSourceGlob) {
+		extensions = append(extensions, "httpfs")
+	}
+	for _, extension := range extensions {
+		if err := loadExtension(db, extension); err != nil {
+			_ = db.Close()
+			return nil, err
+		}
+	}
+
+	for name, value := range cfg.ParquetSourceSettings {
+		if _, err := db.Exec(fmt.Sprintf("SET %s='%s'", name, strings.ReplaceAll(value, "'", "''"))); err != nil {
+			_ = db.Close()
+			return nil, fmt.Errorf("could not set %s: %q", name, err)
+		}
+	}
+
+	// Spans of the plugin cannot be written back to a Parquet source, so only the OTLP exporter applies
+	tracing, _, err := newTracerProvider(logger, cfg, nil)
+	if err != nil {
 		_ = db.Close()
 		return nil, err
 	}
 
+	parquetReader := duckdbspanstore.NewParquetTraceReader(db, cfg.ParquetSourceGlob, cfg.ParquetSourceHivePartitioning, duckdbspanstore.ColumnMapping{
+		TraceID:      cfg.ParquetSourceColumns["trace_id"],
+		SpanID:       cfg.ParquetSourceColumns["span_id"],
+		ParentSpanID: cfg.ParquetSourceColumns["parent_span_id"],
+		Service:      cfg.ParquetSourceColumns["service"],
+		Operation:    cfg.ParquetSourceColumns["operation"],
+		StartTime:    cfg.ParquetSourceColumns["start_time"],
+		Duration:     cfg.ParquetSourceColumns["duration"],
+		DurationUnit: parquetDurationUnits[cfg.ParquetSourceDurationUnit],
+		Tags:         cfg.ParquetSourceColumns["tags"],
+	}, tracerProviderOrNoop(tracing))
+	reader := decorateReader(logger.Named("reader"), parquetReader, cfg, metricsFactory)
+
 	return &Store{
+		logger:        logger,
 		db:            db,
-		writer:        duckdbspanstore.NewSpanWriter(logger, db, cfg.IndexTable, cfg.SpansTable, duckdbspanstore.Encoding(cfg.Encoding), cfg.BatchFlushInterval, cfg.BatchWriteSize),
-		reader:        duckdbspanstore.NewTraceReader(db, cfg.IndexTable, cfg.OperationsTable, cfg.SpansTable),
-		archiveWriter: duckdbspanstore.NewSpanWriter(logger, db, "", cfg.SpansArchiveTable, duckdbspanstore.Encoding(cfg.Encoding), cfg.BatchFlushInterval, cfg.BatchWriteSize),
-		archiveReader: duckdbspanstore.NewTraceReader(db, "", "", cfg.SpansArchiveTable),
+		writer:        readOnlyWriter{},
+		reader:        reader,
+		archiveWriter: readOnlyWriter{},
+		archiveReader: reader,
+		dependencies:  duckdbdependencystore.NewDependencyStore(metricsFactory),
+		exporter:      duckdbspanstore.NewParquetExporter(logger, db, "", "", "", ""),
+		tracing:       tracing,
+		finish:        make(chan bool),
 	}, nil
 }
 
-func connector(cfg Configuration) (*sql.DB, error) {
-	db, err := sql.Open("duckdb", cfg.DataFile)
+func isRemotePath(path string) bool {
+	for _, scheme := range []string{"s3://", "http://", "https://"} {
+		if strings.HasPrefix(path, scheme) {
+			return true
+		}
+	}
+	return false
+}
+
+// tracerProviderOrNoop returns a no-op tracer provider when tracing is disabled
+func tracerProviderOrNoop(provider *sdktrace.TracerProvider) trace.TracerProvider {
+	if provider == nil {
+		return trace.NewNoopTracerProvider()
+	}
+	return provider
+}
+
+// decorateReader adds metrics and, when a threshold is configured, slow query logging to reader
+func decorateReader(logger hclog.Logger, reader spanstore.Reader, cfg Configuration, metricsFactory metrics.Factory) spanstore.Reader {
+	if cfg.SlowQueryThreshold > 0 {
+		reader = duckdbspanstore.NewSlowQueryLogDecorator(reader, logger, cfg.SlowQueryThreshold)
+	}
+	return duckdbspanstore.NewReadMetricsDecorator(reader, metricsFactory)
+}
+
+// archiveMetricsFactory tells the metrics of the archive storage apart from the primary ones
+func archiveMetricsFactory(metricsFactory metrics.Factory) metrics.Factory {
+	return metricsFactory.Namespace(metrics.NSOptions{Name: "archive"})
+}
+
+// connector opens the database at path, an empty path opens an in-memory database. The
+// DuckDB settings of cfg are applied to every connection.
+func connector(path string, cfg Configuration) (*sql.DB, error) {
+	settings := duckDBSettings(cfg)
+	c, err := duckdb.NewConnector(path, func(execer driver.Execer) error {
+		for _, statement := range settings {
+			if _, err := execer.Exec(statement, nil); err != nil {
+				return fmt.Errorf("could not run %s: %w", statement, err)
+			}
+		}
+		return nil
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	return db, nil
+	return sql.OpenDB(c), nil
+}
+
+// dsnWithOption adds a DuckDB config option to the query string of dsn, which may hold options already
+func dsnWithOption(dsn, name, value string) (string, error) {
+	parsed, err := url.Parse(dsn)
+	if err != nil {
+		return "", fmt.Errorf("invalid data file %q: %w", dsn, err)
+	}
+	query := parsed.Query()
+	query.Set(name, value)
+	parsed.RawQuery = query.Encode()
+	return parsed.String(), nil
+}
+
+// duckDBSettings returns the SET statements that apply the DuckDB settings of cfg
+func duckDBSettings(cfg Configuration) []string {
+	var settings []string
+	set := func(name, value string) {
+		settings = append(settings, fmt.Sprintf("SET %s='%s'", name, strings.ReplaceAll(value, "'", "''")))
+	}
+
+	if cfg.DuckDBCheckpointThreshold != "" {
+		set("checkpoint_threshold", cfg.DuckDBCheckpointThreshold)
+	}
+	if cfg.DuckDBMemoryLimit != "" {
+		set("memory_limit", cfg.DuckDBMemoryLimit)
+	}
+	if cfg.DuckDBPreserveInsertionOrder != nil {
+		set("preserve_insertion_order", strconv.FormatBool(*cfg.DuckDBPreserveInsertionOrder))
+	}
+	if cfg.DuckDBTempDirectory != "" {
+		set("temp_directory", cfg.DuckDBTempDirectory)
+	}
+	if cfg.DuckDBThreads > 0 {
+		set("threads", strconv.Itoa(cfg.DuckDBThreads))
+	}
+	for _, name := range sortedKeys(cfg.DuckDBSettings) {
+		set(name, cfg.DuckDBSettings[name])
+	}
+
+	return settings
 }
 
 func (s *Store) SpanReader() spanstore.Reader {
@@ -72,7 +331,12 @@ func (s *Store) SpanWriter() spanstore.Writer {
 }
 
 func (s *Store) DependencyReader() dependencystore.Reader {
-	return duckdbdependencystore.NewDependencyStore()
+	return s.dependencies
+}
+
+// StreamingSpanWriter returns the primary span writer, spans received over a stream are batched like any other
+func (s *Store) StreamingSpanWriter() spanstore.Writer {
+	return s.writer
 }
 
 func (s *Store) ArchiveSpanReader() spanstore.Reader {
@@ -83,12 +347,274 @@ func (s *Store) ArchiveSpanWriter() spanstore.Writer {
 	return s.archiveWriter
 }
 
+// withDB runs fn with the database, or with the current connection of a read-only replica
+func (s *Store) withDB(fn func(db *sql.DB) error) error {
+	if s.replica != nil {
+		return s.replica.withDB(fn)
+	}
+	return fn(s.db)
+}
+
+// withArchiveDB runs fn with the archive database, which is the primary one unless an archive data file is configured
+func (s *Store) withArchiveDB(fn func(db *sql.DB) error) error {
+	switch {
+	case s.archiveReplica != nil:
+		return s.archiveReplica.withDB(fn)
+	case s.archiveDB != nil:
+		return fn(s.archiveDB)
+	default:
+		return s.withDB(fn)
+	}
+}
+
+// FindTraceSummaries searches the primary storage like FindTraces but returns trace summaries,
+// which is much cheaper than reading and decoding every span of the traces found. Only the search
+// command uses it, the gRPC plugin API has no call to return summaries to the Jaeger UI.
+func (s *Store) FindTraceSummaries(ctx context.Context, query *spanstore.TraceQueryParameters) ([]duckdbspanstore.TraceSummary, error) {
+	if s.summaries == nil {
+		return nil, errNoSummaries
+	}
+	return s.summaries.FindTraceSummaries(ctx, query)
+}
+
+// Ping checks that the databases answer queries
+func (s *Store) Ping(ctx context.Context) error {
+	ping := func(db *sql.DB) error {
+		var one int
+		return db.QueryRowContext(ctx, "SELECT 1").Scan(&one)
+	}
+
+	if err := s.withDB(ping); err != nil {
+		return err
+	}
+	return s.withArchiveDB(ping)
+}
+
+// Ready checks that the schema is initialized and that the writers keep up with incoming spans
+func (s *Store) Ready(ctx context.Context) error {
+	if err := s.Ping(ctx); err != nil {
+		return err
+	}
+
+	err := s.withDB(func(db *sql.DB) error {
+		return checkTables(ctx, db, s.schemaTables)
+	})
+	if err != nil {
+		return err
+	}
+
+	err = s.withArchiveDB(func(db *sql.DB) error {
+		return checkTables(ctx, db, s.archiveSchemaTables)
+	})
+	if err != nil {
+		return err
+	}
+
+	if s.maxQueue <= 0 {
+		return nil
+	}
+
+	for _, writer := range []spanstore.Writer{s.writer, s.archiveWriter} {
+		if q, ok := writer.(queueLengther); ok && q.QueueLength() >= s.maxQueue {
+			return fmt.Errorf("%w: %d spans queued", errBacklog, q.QueueLength())
+		}
+	}
+
+	return nil
+}
+
+// ExportParquet moves spans with a start time in [start, end) from the live tables to Parquet files
+func (s *Store) ExportParquet(ctx context.Context, start, end time.Time) ([]duckdbspanstore.ParquetFile, error) {
+	if s.exporter == nil {
+		return nil, errReadOnly
+	}
+	return s.exporter.Export(ctx, start, end)
+}
+
+// checkTables returns an error if one of tables does not exist in db
+func checkTables(ctx context.Context, db *sql.DB, tables []string) error {
+	for _, table := range tables {
+		var count int
+		err := db.QueryRowContext(ctx, "SELECT count(*) FROM information_schema.tables WHERE table_name = ?", table).Scan(&count)
+		if err != nil {
+			return err
+		}
+		if count == 0 {
+			return fmt.Errorf("table %s does not exist", table)
+		}
+	}
+	return nil
+}
+
+// archiveSchemaTables returns the tables of the archive storage, starting with the spans table
+func archiveSchemaTables(cfg Configuration) []string {
+	tables := []string{cfg.SpansArchiveTable}
+	if cfg.ArchiveIndexTable != "" {
+		tables = append(tables, cfg.ArchiveIndexTable)
+	}
+	return tables
+}
+
+// PurgeArchive deletes the archived spans that started before the given time and returns how many there were
+func (s *Store) PurgeArchive(ctx context.Context, before time.Time) (int64, error) {
+	if s.replica != nil || len(s.archiveSchemaTables) == 0 {
+		return 0, errReadOnly
+	}
+
+	var deleted int64
+	err := s.withArchiveDB(func(db *sql.DB) error {
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		defer func() { _ = tx.Rollback() }()
+
+		for i, table := range s.archiveSchemaTables {
+			result, err := tx.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE timestamp < ?", table), before.UTC())
+			if err != nil {
+				return err
+			}
+			if i == 0 {
+				if deleted, err = result.RowsAffected(); err != nil {
+					return err
+				}
+			}
+		}
+
+		return tx.Commit()
+	})
+
+	return deleted, err
+}
+
+func (s *Store) backgroundArchivePurge(retention time.Duration) {
+	defer s.done.Done()
+
+	ticker := time.NewTicker(archivePurgeInterval(retention))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			deleted, err := s.PurgeArchive(context.Background(), time.Now().Add(-retention))
+			if err != nil {
+				s.logger.Error("Could not purge the archive", "error", err)
+			}
+			s.logger.Debug("Archive purge finished", "spans", deleted)
+		case <-s.finish:
+			return
+		}
+	}
+}
+
+// archivePurgeInterval checks for expired archived spans ten times per retention period,
+// but not more often than every second nor less often than hourly
+func archivePurgeInterval(retention time.Duration) time.Duration {
+	switch interval := retention / 10; {
+	case interval < time.Second:
+		return time.Second
+	case interval > time.Hour:
+		return time.Hour
+	default:
+		return interval
+	}
+}
+
+func (s *Store) backgroundExporter(interval, age time.Duration) {
+	defer s.done.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			files, err := s.exporter.Export(context.Background(), time.Unix(0, 0), time.Now().Add(-age))
+			if err != nil {
+				s.logger.Error("Could not export spans to parquet", "error", err)
+			}
+			s.logger.Debug("Parquet export finished", "files", len(files))
+		case <-s.finish:
+			return
+		}
+	}
+}
+
+// Close flushes the writers and closes the databases. A batch the writers failed to write is
+// reported once everything is closed.
 func (s *Store) Close() error {
+	close(s.finish)
+	s.done.Wait()
+
+	var writeErr error
+	for _, writer := range []spanstore.Writer{s.writer, s.archiveWriter} {
+		if closer, ok := writer.(io.Closer); ok {
+			if err := closer.Close(); err != nil && writeErr == nil {
+				writeErr = err
+			}
+		}
+	}
+
+	if s.tracing != nil {
+		if err := s.tracing.Shutdown(context.Background()); err != nil {
+			s.logger.Error("Could not flush the spans of the plugin", "error", err)
+		}
+	}
+
+	if s.tracingWriter != nil {
+		if err := s.tracingWriter.Close(); err != nil && writeErr == nil {
+			writeErr = err
+		}
+	}
+
+	if err := s.closeDatabases(); err != nil {
+		return err
+	}
+	return writeErr
+}
+
+func (s *Store) closeDatabases() error {
+	if s.replica != nil {
+		if err := s.replica.close(); err != nil {
+			return err
+		}
+		return s.archiveReplica.close()
+	}
+
+	if s.archiveDB != nil {
+		if err := s.archiveDB.Close(); err != nil {
+			return err
+		}
+	}
+
 	return s.db.Close()
 }
 
+// readOnlyWriter rejects all writes
+type readOnlyWriter struct{}
+
+func (readOnlyWriter) WriteSpan(context.Context, *model.Span) error {
+	return errReadOnly
+}
+
+func loadExtension(db *sql.DB, name string) error {
+	if _, err := db.Exec(fmt.Sprintf("INSTALL %s", name)); err != nil {
+		return fmt.Errorf("could not install %s extension: %q", name, err)
+	}
+	if _, err := db.Exec(fmt.Sprintf("LOAD %s", name)); err != nil {
+		return fmt.Errorf("could not load %s extension: %q", name, err)
+	}
+	return nil
+}
+
+// sqlScript is a schema file and the statements it holds
+type sqlScript struct {
+	path      string
+	statement string
+}
+
 func runInitScripts(logger hclog.Logger, db *sql.DB, cfg Configuration) error {
-	var ddlStatements []string
+	var scripts []sqlScript
 	filePaths, err := walkMatch(cfg.InitSQLScriptsDir, "*.sql")
 	if err != nil {
 		return fmt.Errorf("could not list sql files: %q", err)
@@ -99,12 +625,12 @@ func runInitScripts(logger hclog.Logger, db *sql.DB, cfg Configuration) error {
 		if err != nil {
 			return err
 		}
-		ddlStatements = append(ddlStatements, string(ddlStatement))
+		scripts = append(scripts, sqlScript{path: f, statement: string(ddlStatement)})
 	}
-	return executeScripts(logger, ddlStatements, db)
+	return executeScripts(logger, scripts, db)
 }
 
-func executeScripts(logger hclog.Logger, ddlStatements []string, db *sql.DB) error {
+func executeScripts(logger hclog.Logger, scripts []sqlScript, db *sql.DB) error {
 	tx, err := db.Begin()
 	if err != nil {
 		return err
@@ -116,11 +642,11 @@ func executeScripts(logger hclog.Logger, ddlStatements []string, db *sql.DB) err
 		}
 	}()
 
-	for _, statement := range ddlStatements {
-		logger.Debug("Running SQL statement", "statement", statement)
-		_, err = tx.Exec(statement)
+	for _, script := range scripts {
+		logger.Debug("Running SQL script", "file", script.path)
+		_, err = tx.Exec(script.statement)
 		if err != nil {
-			return fmt.Errorf("could not run sql %q: %q", statement, err)
+			return fmt.Errorf("could not run sql script %s: %q", script.path, err)
 		}
 	}
 	committed = true
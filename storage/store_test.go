@@ -0,0 +1,434 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/jaegertracing/jaeger/model"
+	"github.com/jaegertracing/jaeger/storage/spanstore"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/jaeger-lib/metrics"
+)
+
+func TestDuckDBSettings(t *testing.T) {
+	preserveInsertionOrder := false
+	cfg := Configuration{
+		DuckDBCheckpointThreshold:    "8MB",
+		DuckDBMemoryLimit:            "512MB",
+		DuckDBPreserveInsertionOrder: &preserveInsertionOrder,
+		DuckDBSettings:               map[string]string{"default_order": "desc", "enable_progress_bar": "false"},
+		DuckDBTempDirectory:          "/tmp/it's",
+		DuckDBThreads:                2,
+	}
+
+	assert.Equal(t, []string{
+		"SET checkpoint_threshold='8MB'",
+		"SET memory_limit='512MB'",
+		"SET preserve_insertion_order='false'",
+		"SET temp_directory='/tmp/it''s'",
+		"SET threads='2'",
+		"SET default_order='desc'",
+		"SET enable_progress_bar='false'",
+	}, duckDBSettings(cfg))
+
+	assert.Empty(t, duckDBSettings(Configuration{}))
+}
+
+func TestConnector_appliesSettings(t *testing.T) {
+	preserveInsertionOrder := false
+	db, err := connector("", Configuration{
+		DuckDBMemoryLimit:            "256MB",
+		DuckDBPreserveInsertionOrder: &preserveInsertionOrder,
+		DuckDBThreads:                2,
+		DuckDBSettings:               map[string]string{"default_order": "desc"},
+	})
+	require.NoError(t, err)
+	defer db.Close()
+
+	// Open several connections so that each one runs the init hook
+	db.SetMaxIdleConns(0)
+	for i := 0; i < 3; i++ {
+		var threads, order, preserve string
+		err := db.QueryRow("SELECT current_setting('threads'), current_setting('default_order'), current_setting('preserve_insertion_order')").Scan(&threads, &order, &preserve)
+		require.NoError(t, err)
+		assert.Equal(t, "2", threads)
+		assert.Equal(t, "desc", order)
+		assert.Equal(t, "false", preserve)
+	}
+}
+
+func TestConnector_invalidSetting(t *testing.T) {
+	db, err := connector("", Configuration{DuckDBSettings: map[string]string{"no_such_setting": "1"}})
+	if err == nil {
+		err = db.Ping()
+		_ = db.Close()
+	}
+	assert.ErrorContains(t, err, "no_such_setting")
+}
+
+func TestStore_archiveDataFile(t *testing.T) {
+	dir := t.TempDir()
+	cfg := Configuration{
+		DataFile:                  filepath.Join(dir, "jaeger.db"),
+		ArchiveDataFile:           filepath.Join(dir, "archive.db"),
+		ArchiveBatchFlushInterval: time.Millisecond,
+		ArchiveBatchWriteSize:     1,
+		InitSQLScriptsDir:         "../schema",
+	}
+	store, err := NewStore(hclog.NewNullLogger(), cfg, metrics.NullFactory)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	now := time.Now()
+	for i, startTime := range []time.Time{now.Add(-48 * time.Hour), now} {
+		err := store.ArchiveSpanWriter().WriteSpan(ctx, &model.Span{
+			TraceID:       model.NewTraceID(0, uint64(i+1)),
+			SpanID:        model.NewSpanID(uint64(i + 1)),
+			OperationName: "GET /",
+			StartTime:     startTime,
+			Process:       model.NewProcess("frontend", nil),
+		})
+		require.NoError(t, err)
+	}
+	require.NoError(t, store.Close())
+
+	countArchived := func(path string) int {
+		db, err := connector(path, Configuration{})
+		require.NoError(t, err)
+		defer db.Close()
+
+		var count int
+		require.NoError(t, db.QueryRow("SELECT count(*) FROM jaeger_spans_archive").Scan(&count))
+		return count
+	}
+	assert.Equal(t, 0, countArchived(cfg.DataFile))
+	assert.Equal(t, 2, countArchived(cfg.ArchiveDataFile))
+
+	store, err = NewStore(hclog.NewNullLogger(), cfg, metrics.NullFactory)
+	require.NoError(t, err)
+	defer store.Close()
+
+	assert.NoError(t, store.Ready(ctx))
+
+	deleted, err := store.PurgeArchive(ctx, now.Add(-24*time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), deleted)
+
+	trace, err := store.ArchiveSpanReader().GetTrace(ctx, model.NewTraceID(0, 2))
+	require.NoError(t, err)
+	assert.Len(t, trace.Spans, 1)
+
+	_, err = store.ArchiveSpanReader().GetTrace(ctx, model.NewTraceID(0, 1))
+	assert.ErrorIs(t, err, spanstore.ErrTraceNotFound)
+}
+
+func TestStore_archiveIndex(t *testing.T) {
+	cfg := Configuration{
+		DataFile:               filepath.Join(t.TempDir(), "jaeger.db"),
+		ArchiveIndexTable:      "jaeger_index_archive",
+		ArchiveOperationsTable: "jaeger_operations_archive",
+		InitSQLScriptsDir:      "../schema",
+	}
+	store, err := NewStore(hclog.NewNullLogger(), cfg, metrics.NullFactory)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	now := time.Now()
+	spans := []*model.Span{
+		{
+			OperationName: "GET /",
+			Duration:      time.Millisecond,
+			Process:       model.NewProcess("frontend", nil),
+			Tags:          []model.KeyValue{model.String("http.method", "GET")},
+		},
+		{
+			OperationName: "SELECT",
+			Duration:      time.Second,
+			Process:       model.NewProcess("backend", nil),
+			Tags:          []model.KeyValue{model.String("db.system", "duckdb")},
+		},
+	}
+	for i, span := range spans {
+		span.TraceID = model.NewTraceID(0, uint64(i+1))
+		span.SpanID = model.NewSpanID(uint64(i + 1))
+		span.StartTime = now
+		require.NoError(t, store.ArchiveSpanWriter().WriteSpan(ctx, span))
+	}
+	require.NoError(t, store.Close())
+
+	store, err = NewStore(hclog.NewNullLogger(), cfg, metrics.NullFactory)
+	require.NoError(t, err)
+	defer store.Close()
+
+	assert.NoError(t, store.Ready(ctx))
+
+	services, err := store.ArchiveSpanReader().GetServices(ctx)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"frontend", "backend"}, services)
+
+	operations, err := store.ArchiveSpanReader().GetOperations(ctx, spanstore.OperationQueryParameters{ServiceName: "backend"})
+	require.NoError(t, err)
+	assert.Equal(t, []spanstore.Operation{{Name: "SELECT"}}, operations)
+
+	services, err = store.SpanReader().GetServices(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, services, "archived spans are not indexed with the live ones")
+
+	query := func(query spanstore.TraceQueryParameters) []model.TraceID {
+		query.StartTimeMin = now.Add(-time.Hour)
+		query.StartTimeMax = now.Add(time.Hour)
+		query.NumTraces = 10
+		traces, err := store.ArchiveSpanReader().FindTraces(ctx, &query)
+		require.NoError(t, err)
+
+		var traceIDs []model.TraceID
+		for _, trace := range traces {
+			traceIDs = append(traceIDs, trace.Spans[0].TraceID)
+		}
+		return traceIDs
+	}
+	assert.Equal(t, []model.TraceID{model.NewTraceID(0, 1)}, query(spanstore.TraceQueryParameters{ServiceName: "frontend"}))
+	assert.Equal(t, []model.TraceID{model.NewTraceID(0, 2)}, query(spanstore.TraceQueryParameters{ServiceName: "backend", OperationName: "SELECT"}))
+	assert.Equal(t, []model.TraceID{model.NewTraceID(0, 2)}, query(spanstore.TraceQueryParameters{ServiceName: "backend", Tags: map[string]string{"db.system": "duckdb"}}))
+	assert.Empty(t, query(spanstore.TraceQueryParameters{ServiceName: "backend", Tags: map[string]string{"db.system": "sqlite"}}))
+	assert.Empty(t, query(spanstore.TraceQueryParameters{ServiceName: "backend", DurationMax: time.Millisecond}))
+
+	deleted, err := store.PurgeArchive(ctx, now.Add(time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), deleted)
+
+	services, err = store.ArchiveSpanReader().GetServices(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, services)
+}
+
+func TestStore_repeatedWrites(t *testing.T) {
+	cfg := Configuration{
+		DataFile:          filepath.Join(t.TempDir(), "jaeger.db"),
+		InitSQLScriptsDir: "../schema",
+	}
+
+	span := &model.Span{
+		TraceID:       model.NewTraceID(0, 1),
+		SpanID:        model.NewSpanID(1),
+		OperationName: "GET /",
+		StartTime:     time.Now(),
+		Process:       model.NewProcess("frontend", nil),
+	}
+
+	ctx := context.Background()
+	for i := 0; i < 2; i++ {
+		store, err := NewStore(hclog.NewNullLogger(), cfg, metrics.NullFactory)
+		require.NoError(t, err)
+		for j := 0; j < 2; j++ {
+			require.NoError(t, store.SpanWriter().WriteSpan(ctx, span))
+			require.NoError(t, store.ArchiveSpanWriter().WriteSpan(ctx, span))
+		}
+		require.NoError(t, store.Close())
+	}
+
+	store, err := NewStore(hclog.NewNullLogger(), cfg, metrics.NullFactory)
+	require.NoError(t, err)
+	defer store.Close()
+
+	count := func(table string) int {
+		var count int
+		require.NoError(t, store.db.QueryRow(fmt.Sprintf("SELECT count(*) FROM %s", table)).Scan(&count))
+		return count
+	}
+	assert.Equal(t, 1, count("jaeger_spans"))
+	assert.Equal(t, 1, count("jaeger_index"))
+	assert.Equal(t, 1, count("jaeger_spans_archive"))
+
+	// A row written before spans had an ID column is only deduplicated on read
+	serialized, err := json.Marshal(span)
+	require.NoError(t, err)
+	_, err = store.db.Exec("INSERT INTO jaeger_spans (timestamp, traceID, model) VALUES (?, ?, ?)", span.StartTime, span.TraceID.String(), string(serialized))
+	require.NoError(t, err)
+
+	for _, reader := range []spanstore.Reader{store.SpanReader(), store.ArchiveSpanReader()} {
+		trace, err := reader.GetTrace(ctx, span.TraceID)
+		require.NoError(t, err)
+		assert.Len(t, trace.Spans, 1)
+	}
+}
+
+func TestStore_archiveSyncWrites(t *testing.T) {
+	cfg := Configuration{
+		DataFile:                  filepath.Join(t.TempDir(), "jaeger.db"),
+		ArchiveBatchFlushInterval: time.Hour,
+		ArchiveSyncWrites:         true,
+		InitSQLScriptsDir:         "../schema",
+	}
+	store, err := NewStore(hclog.NewNullLogger(), cfg, metrics.NullFactory)
+	require.NoError(t, err)
+	defer store.Close()
+
+	ctx := context.Background()
+	span := &model.Span{
+		TraceID:       model.NewTraceID(0, 1),
+		SpanID:        model.NewSpanID(1),
+		OperationName: "GET /",
+		StartTime:     time.Now(),
+		Process:       model.NewProcess("frontend", nil),
+	}
+	require.NoError(t, store.ArchiveSpanWriter().WriteSpan(ctx, span))
+
+	trace, err := store.ArchiveSpanReader().GetTrace(ctx, span.TraceID)
+	require.NoError(t, err, "the span is stored once WriteSpan returns")
+	assert.Len(t, trace.Spans, 1)
+
+	_, err = store.db.ExecContext(ctx, "DROP TABLE jaeger_spans_archive")
+	require.NoError(t, err)
+	assert.Error(t, store.ArchiveSpanWriter().WriteSpan(ctx, span), "write errors are returned to the caller")
+}
+
+func TestStore_concurrentWrites(t *testing.T) {
+	cfg := Configuration{
+		DataFile:          filepath.Join(t.TempDir(), "jaeger.db"),
+		SyncWrites:        true,
+		InitSQLScriptsDir: "../schema",
+	}
+	store, err := NewStore(hclog.NewNullLogger(), cfg, metrics.NullFactory)
+	require.NoError(t, err)
+	defer store.Close()
+
+	// Several collectors write the spans of a trace at once, as when retrying a request, each span must be stored once
+	ctx := context.Background()
+	errs := make(chan error, 40)
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				errs <- store.SpanWriter().WriteSpan(ctx, &model.Span{
+					TraceID:       model.NewTraceID(0, 1),
+					SpanID:        model.NewSpanID(uint64(j + 1)),
+					OperationName: "GET /",
+					StartTime:     time.Now(),
+					Process:       model.NewProcess("frontend", nil),
+				})
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		require.NoError(t, err)
+	}
+
+	count := func(query string) int {
+		var count int
+		require.NoError(t, store.db.QueryRow(query).Scan(&count))
+		return count
+	}
+	assert.Equal(t, 10, count("SELECT count(*) FROM jaeger_spans"))
+	assert.Equal(t, 10, count("SELECT count(*) FROM jaeger_index"))
+	assert.Equal(t, 10, count("SELECT sum(rowCount) FROM jaeger_index_stats"))
+	assert.Equal(t, 10, count("SELECT spanCount FROM jaeger_traces"))
+}
+
+func TestStore_statsCompaction(t *testing.T) {
+	cfg := Configuration{
+		DataFile:          filepath.Join(t.TempDir(), "jaeger.db"),
+		SyncWrites:        true,
+		InitSQLScriptsDir: "../schema",
+	}
+
+	// Stats appended by every batch before the table was keyed
+	db, err := sql.Open("duckdb", cfg.DataFile)
+	require.NoError(t, err)
+	for _, statement := range []string{
+		"CREATE TABLE jaeger_index_stats (hour Timestamp, service String, operation String, rowCount UInt64)",
+		"INSERT INTO jaeger_index_stats VALUES ('2022-01-01 10:00:00', 'frontend', 'GET /', 1), ('2022-01-01 10:00:00', 'frontend', 'GET /', 2)",
+		"INSERT INTO jaeger_index_stats VALUES ('2022-01-01 10:00:00', 'frontend', 'GET /', 3), ('2022-01-01 10:00:00', 'frontend', 'POST /', 4)",
+	} {
+		_, err := db.Exec(statement)
+		require.NoError(t, err)
+	}
+	require.NoError(t, db.Close())
+
+	store, err := NewStore(hclog.NewNullLogger(), cfg, metrics.NullFactory)
+	require.NoError(t, err)
+	defer store.Close()
+
+	require.NoError(t, store.SpanWriter().WriteSpan(context.Background(), &model.Span{
+		TraceID:       model.NewTraceID(0, 1),
+		SpanID:        model.NewSpanID(1),
+		OperationName: "GET /",
+		StartTime:     time.Date(2022, 1, 1, 10, 30, 0, 0, time.UTC),
+		Process:       model.NewProcess("frontend", nil),
+	}))
+
+	rows, err := store.db.Query("SELECT operation, rowCount FROM jaeger_index_stats ORDER BY operation")
+	require.NoError(t, err)
+	defer rows.Close()
+
+	counts := map[string]int64{}
+	for rows.Next() {
+		var operation string
+		var count int64
+		require.NoError(t, rows.Scan(&operation, &count))
+		counts[operation] = count
+	}
+	require.NoError(t, rows.Err())
+	assert.Equal(t, map[string]int64{"GET /": 7, "POST /": 4}, counts)
+}
+
+func TestArchivePurgeInterval(t *testing.T) {
+	assert.Equal(t, time.Second, archivePurgeInterval(time.Millisecond))
+	assert.Equal(t, time.Minute, archivePurgeInterval(10*time.Minute))
+	assert.Equal(t, time.Hour, archivePurgeInterval(30*24*time.Hour))
+}
+
+// queuedWriter reports a fixed queue length
+type queuedWriter struct {
+	spanstore.Writer
+	length int
+}
+
+func (w queuedWriter) QueueLength() int {
+	return w.length
+}
+
+func TestStore_Ready(t *testing.T) {
+	cfg := Configuration{
+		DataFile:          filepath.Join(t.TempDir(), "jaeger.db"),
+		BatchWriteSize:    10,
+		InitSQLScriptsDir: "../schema",
+	}
+	store, err := NewStore(hclog.NewNullLogger(), cfg, metrics.NullFactory)
+	require.NoError(t, err)
+	defer store.Close()
+
+	ctx := context.Background()
+	assert.NoError(t, store.Ping(ctx))
+	assert.NoError(t, store.Ready(ctx))
+
+	// Readiness fails once a queue holds 8 of its 10 spans, before WriteSpan blocks
+	writer := store.writer
+	store.writer = queuedWriter{Writer: writer, length: 7}
+	assert.NoError(t, store.Ready(ctx))
+	store.writer = queuedWriter{Writer: writer, length: 8}
+	assert.ErrorIs(t, store.Ready(ctx), errBacklog)
+	store.writer = writer
+
+	_, err = store.db.ExecContext(ctx, "DROP TABLE jaeger_traces")
+	require.NoError(t, err)
+	assert.NoError(t, store.Ping(ctx))
+	assert.ErrorContains(t, store.Ready(ctx), "table jaeger_traces does not exist")
+
+	require.NoError(t, store.db.Close())
+	assert.Error(t, store.Ping(ctx))
+	assert.Error(t, store.Ready(ctx))
+}
@@ -0,0 +1,93 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	hclog "github.com/hashicorp/go-hclog"
+	"github.com/jaegertracing/jaeger/storage/spanstore"
+	"github.com/uber/jaeger-lib/metrics"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/chhetripradeep/jaeger-duckdb/converter"
+	"github.com/chhetripradeep/jaeger-duckdb/storage/duckdbspanstore"
+)
+
+// tracingServiceName is the service the spans of the plugin are reported under
+const tracingServiceName = "jaeger-duckdb"
+
+// newTracerProvider returns the tracer provider configured by cfg.TracingExporter, or nil when
+// tracing is disabled. With the self exporter, the returned writer stores the spans in db and
+// must be closed once the provider is shut down.
+func newTracerProvider(logger hclog.Logger, cfg Configuration, db *sql.DB) (*sdktrace.TracerProvider, *duckdbspanstore.SpanWriter, error) {
+	var (
+		exporter sdktrace.SpanExporter
+		writer   *duckdbspanstore.SpanWriter
+	)
+
+	switch cfg.TracingExporter {
+	case "", "none":
+		return nil, nil, nil
+	case TracingExporterOTLP:
+		options := []otlptracegrpc.Option{otlptracegrpc.WithEndpoint(cfg.TracingOTLPEndpoint)}
+		if cfg.TracingOTLPInsecure {
+			options = append(options, otlptracegrpc.WithInsecure())
+		}
+		otlpExporter, err := otlptracegrpc.New(context.Background(), options...)
+		if err != nil {
+			return nil, nil, fmt.Errorf("could not create otlp exporter: %w", err)
+		}
+		exporter = otlpExporter
+	case TracingExporterSelf:
+		if db == nil {
+			return nil, nil, fmt.Errorf("tracing exporter %q needs a writable database", cfg.TracingExporter)
+		}
+		// The writer is not traced itself, otherwise every flush of our own spans would produce new ones
+		writer = duckdbspanstore.NewSpanWriter(
+			logger.Named("tracing"), db, cfg.IndexTable, cfg.IndexStatsTable, cfg.SpansTable, cfg.TracesTable, duckdbspanstore.Encoding(cfg.Encoding),
+			cfg.BatchFlushInterval, cfg.BatchWriteSize, false, metrics.NullFactory, trace.NewNoopTracerProvider(),
+		)
+		exporter = &selfExporter{writer: writer}
+	default:
+		return nil, nil, fmt.Errorf("unknown tracing exporter %q", cfg.TracingExporter)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.TracingSamplingRatio))),
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", tracingServiceName))),
+	)
+
+	return provider, writer, nil
+}
+
+// selfExporter writes the spans of the plugin to its own span and index tables
+type selfExporter struct {
+	writer spanstore.Writer
+}
+
+var _ sdktrace.SpanExporter = (*selfExporter)(nil)
+
+func (e *selfExporter) ExportSpans(ctx context.Context, otelSpans []sdktrace.ReadOnlySpan) error {
+	spans, err := converter.FromOTelSpans(otelSpans)
+	if err != nil {
+		return err
+	}
+
+	for _, span := range spans {
+		if err := e.writer.WriteSpan(ctx, span); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (e *selfExporter) Shutdown(context.Context) error {
+	return nil
+}